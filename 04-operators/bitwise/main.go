@@ -432,6 +432,24 @@ func demonstratePracticalBitwiseExamples() {
 	var original uint8 = 0b10110010
 	var reversed uint8 = reverseBits(original)
 	fmt.Printf("Original: %08b, Reversed: %08b\n", original, reversed)
+
+	// Checksums for lightweight integrity checks
+	fmt.Printf("\nChecksum (Adler-32):\n")
+	var message []byte = []byte("Wikipedia")
+	fmt.Printf("Checksum(%q) = 0x%08X\n", message, Checksum(message))
+	var tampered []byte = []byte("Wikipedio")
+	fmt.Printf("Checksum(%q) = 0x%08X (one byte changed)\n", tampered, Checksum(tampered))
+
+	// XOR masking is reversible: (data ^ key) ^ key == data
+	fmt.Printf("\nXOR masking:\n")
+	var data []byte = []byte("go")
+	var key []byte = []byte{0x5A, 0xA5}
+	masked, _ := XORBytes(data, key)
+	unmasked, _ := XORBytes(masked, key)
+	fmt.Printf("Data: %08b, Masked: %08b, Unmasked: %q\n", data, masked, unmasked)
+	if _, err := XORBytes(data, []byte{1}); err != nil {
+		fmt.Printf("Mismatched lengths: %v\n", err)
+	}
 }
 
 func demonstrateBitwiseOperatorPrecedence() {
@@ -588,3 +606,29 @@ func reverseBits(value uint8) uint8 {
 	}
 	return result
 }
+
+// Checksum computes the Adler-32 checksum of data: two running sums packed
+// into one uint32 with a shift and an OR
+func Checksum(data []byte) uint32 {
+	const mod = 65521 // largest prime below 2^16
+
+	var a, b uint32 = 1, 0
+	for _, c := range data {
+		a = (a + uint32(c)) % mod
+		b = (b + a) % mod
+	}
+	return b<<16 | a
+}
+
+// XORBytes returns a[i] ^ b[i] for every byte; both slices must be the same length
+func XORBytes(a, b []byte) ([]byte, error) {
+	if len(a) != len(b) {
+		return nil, fmt.Errorf("XORBytes: length mismatch (%d != %d)", len(a), len(b))
+	}
+
+	result := make([]byte, len(a))
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+	return result, nil
+}
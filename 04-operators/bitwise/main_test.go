@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"hash/adler32"
+	"testing"
+)
+
+// === CHECKSUM ===
+
+func TestChecksumKnownVectors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint32
+	}{
+		{"", 0x00000001},
+		{"a", 0x00620062},
+		{"abc", 0x024D0127},
+		{"Wikipedia", 0x11E60398},
+	}
+
+	for _, tt := range tests {
+		if got := Checksum([]byte(tt.in)); got != tt.want {
+			t.Errorf("Checksum(%q) = 0x%08X, want 0x%08X", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestChecksumMatchesAdler32OnLargeInput(t *testing.T) {
+	// Large enough for both sums to wrap the modulus many times
+	data := bytes.Repeat([]byte{0xFF}, 100000)
+	if got, want := Checksum(data), adler32.Checksum(data); got != want {
+		t.Errorf("Checksum = 0x%08X, want 0x%08X", got, want)
+	}
+}
+
+func TestChecksumDetectsSingleByteChange(t *testing.T) {
+	if Checksum([]byte("Wikipedia")) == Checksum([]byte("Wikipedio")) {
+		t.Error("one changed byte gave the same checksum")
+	}
+}
+
+// === XOR BYTES ===
+
+func TestXORBytes(t *testing.T) {
+	got, err := XORBytes([]byte{0x0F, 0xF0, 0xAA}, []byte{0xFF, 0xFF, 0xAA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xF0, 0x0F, 0x00}; !bytes.Equal(got, want) {
+		t.Errorf("XORBytes = % X, want % X", got, want)
+	}
+}
+
+func TestXORBytesIsReversible(t *testing.T) {
+	data, key := []byte("secret"), []byte("kkkkkk")
+	masked, _ := XORBytes(data, key)
+	restored, err := XORBytes(masked, key)
+	if err != nil || !bytes.Equal(restored, data) {
+		t.Errorf("unmasked = %q, %v; want %q", restored, err, data)
+	}
+}
+
+func TestXORBytesRejectsMismatchedLengths(t *testing.T) {
+	if got, err := XORBytes([]byte{1, 2, 3}, []byte{1, 2}); err == nil {
+		t.Errorf("XORBytes = % X, want a length error", got)
+	}
+}
+
+func TestXORBytesEmpty(t *testing.T) {
+	got, err := XORBytes(nil, []byte{})
+	if err != nil || len(got) != 0 {
+		t.Errorf("XORBytes on empty input = % X, %v; want empty, nil", got, err)
+	}
+}
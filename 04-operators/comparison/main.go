@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
 	"math"
 	"strings"
@@ -376,11 +377,24 @@ func demonstrateTypeSpecificComparison() {
 	fmt.Printf("person1 == person2: %t\n", person1 == person2)
 	fmt.Printf("person1 == person3: %t\n", person1 == person3)
 
+	// Slice comparison - slices only compare to nil, so use a helper
+	before := []string{"read", "write", "admin"}
+	after := []string{"read", "write", "deploy"}
+
+	fmt.Printf("Slice comparison:\n")
+	fmt.Printf("EqualSlices(before, before): %t\n", EqualSlices(before, before))
+	fmt.Printf("EqualSlices(before, after): %t\n", EqualSlices(before, after))
+	fmt.Printf("EqualSlices([1 2], [2 1]): %t (order matters)\n", EqualSlices([]int{1, 2}, []int{2, 1}))
+
+	added, removed := Diff(before, after)
+	fmt.Printf("Diff(before, after): added=%v removed=%v\n", added, removed)
+
 	// COMPARISON WITH JAVASCRIPT:
 	// JavaScript: Objects compared by reference
 	// JavaScript: Arrays compared by reference
 	// Go: Arrays compared by value
 	// Go: Structs compared by value
+	// Go: Slices not comparable with == (use a helper)
 	// Go: Pointers compared by address
 }
 
@@ -421,13 +435,20 @@ func demonstrateComparisonChaining() {
 
 	fmt.Printf("Values in range [%d, %d]:\n", min, max)
 	for _, val := range values {
-		if min <= val && val <= max {
+		if InRange(val, min, max) {
 			fmt.Printf("%d is in range\n", val)
 		} else {
 			fmt.Printf("%d is out of range\n", val)
 		}
 	}
 
+	// Generic helpers work for any ordered type
+	fmt.Printf("FilterInRange(%v, %d, %d): %v\n", values, min, max,
+		FilterInRange(values, min, max))
+	fmt.Printf("InRangeExclusive(10, 1, 10): %t\n", InRangeExclusive(10, 1, 10))
+	fmt.Printf("InRange(2.5, 1.0, 3.0): %t\n", InRange(2.5, 1.0, 3.0))
+	fmt.Printf("InRange(\"m\", \"a\", \"z\"): %t\n", InRange("m", "a", "z"))
+
 	// Comparison with multiple conditions
 	var score int = 85
 
@@ -536,3 +557,64 @@ func demonstrateComparisonBestPractices() {
 func floatEquals(a, b, epsilon float64) bool {
 	return math.Abs(a-b) < epsilon
 }
+
+// InRange reports whether lo <= v <= hi (inclusive on both ends)
+func InRange[T cmp.Ordered](v, lo, hi T) bool {
+	return lo <= v && v <= hi
+}
+
+// InRangeExclusive reports whether lo < v < hi (exclusive on both ends)
+func InRangeExclusive[T cmp.Ordered](v, lo, hi T) bool {
+	return lo < v && v < hi
+}
+
+// FilterInRange returns the values that fall within [lo, hi], preserving order
+func FilterInRange[T cmp.Ordered](values []T, lo, hi T) []T {
+	result := make([]T, 0, len(values))
+	for _, v := range values {
+		if InRange(v, lo, hi) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// EqualSlices reports whether a and b hold the same elements in the same
+// order. Slices can't be compared with == like arrays can.
+func EqualSlices[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff returns the elements of b missing from a (added) and the elements of
+// a missing from b (removed). Duplicates are matched one for one.
+func Diff[T comparable](a, b []T) (added, removed []T) {
+	counts := make(map[T]int, len(a))
+	for _, v := range a {
+		counts[v]++
+	}
+
+	for _, v := range b {
+		if counts[v] > 0 {
+			counts[v]--
+		} else {
+			added = append(added, v)
+		}
+	}
+
+	for _, v := range a {
+		if counts[v] > 0 {
+			counts[v]--
+			removed = append(removed, v)
+		}
+	}
+
+	return added, removed
+}
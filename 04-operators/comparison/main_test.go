@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// === RANGE CHECKS ===
+
+func TestInRangeInts(t *testing.T) {
+	tests := []struct {
+		v         int
+		inclusive bool
+		exclusive bool
+	}{
+		{0, false, false},
+		{1, true, false},
+		{5, true, true},
+		{10, true, false},
+		{11, false, false},
+	}
+
+	for _, tt := range tests {
+		if got := InRange(tt.v, 1, 10); got != tt.inclusive {
+			t.Errorf("InRange(%d, 1, 10) = %t, want %t", tt.v, got, tt.inclusive)
+		}
+		if got := InRangeExclusive(tt.v, 1, 10); got != tt.exclusive {
+			t.Errorf("InRangeExclusive(%d, 1, 10) = %t, want %t", tt.v, got, tt.exclusive)
+		}
+	}
+}
+
+func TestInRangeFloats(t *testing.T) {
+	if !InRange(1.0, 1.0, 3.0) || !InRange(3.0, 1.0, 3.0) {
+		t.Error("InRange should include both float bounds")
+	}
+	if InRangeExclusive(1.0, 1.0, 3.0) || InRangeExclusive(3.0, 1.0, 3.0) {
+		t.Error("InRangeExclusive should exclude both float bounds")
+	}
+	if !InRangeExclusive(1.0000001, 1.0, 3.0) {
+		t.Error("InRangeExclusive(1.0000001, 1, 3) = false, want true")
+	}
+	if InRange(3.0000001, 1.0, 3.0) {
+		t.Error("InRange(3.0000001, 1, 3) = true, want false")
+	}
+}
+
+func TestInRangeStrings(t *testing.T) {
+	if !InRange("apple", "apple", "cherry") || !InRange("cherry", "apple", "cherry") {
+		t.Error("InRange should include both string bounds")
+	}
+	if !InRange("banana", "apple", "cherry") {
+		t.Error(`InRange("banana", "apple", "cherry") = false, want true`)
+	}
+	if InRangeExclusive("apple", "apple", "cherry") {
+		t.Error(`InRangeExclusive("apple", "apple", "cherry") = true, want false`)
+	}
+	// Strings compare byte-wise, so uppercase sorts before lowercase
+	if InRange("Banana", "apple", "cherry") {
+		t.Error(`InRange("Banana", "apple", "cherry") = true, want false`)
+	}
+}
+
+func TestInRangeEmptyWhenBoundsReversed(t *testing.T) {
+	if InRange(5, 10, 1) {
+		t.Error("InRange(5, 10, 1) = true, want false for reversed bounds")
+	}
+}
+
+func TestFilterInRange(t *testing.T) {
+	got := FilterInRange([]int{0, 5, 15, 8, 12, 1, 10}, 1, 10)
+	if want := []int{5, 8, 1, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterInRange = %v, want %v", got, want)
+	}
+
+	if got := FilterInRange([]string{"x", "y"}, "a", "b"); got == nil || len(got) != 0 {
+		t.Errorf("FilterInRange with no matches = %#v, want an empty slice", got)
+	}
+}
+
+// === SLICE COMPARISON ===
+
+func TestEqualSlices(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []int
+		want bool
+	}{
+		{"equal", []int{1, 2, 3}, []int{1, 2, 3}, true},
+		{"different length", []int{1, 2, 3}, []int{1, 2}, false},
+		{"reordered", []int{1, 2, 3}, []int{3, 2, 1}, false},
+		{"same length different values", []int{1, 2, 3}, []int{1, 2, 4}, false},
+		{"both empty", []int{}, []int{}, true},
+		{"nil equals empty", nil, []int{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EqualSlices(tt.a, tt.b); got != tt.want {
+				t.Errorf("EqualSlices(%v, %v) = %t, want %t", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name           string
+		a, b           []string
+		added, removed []string
+	}{
+		{"identical", []string{"a", "b"}, []string{"a", "b"}, nil, nil},
+		{"reordered has no changes", []string{"a", "b"}, []string{"b", "a"}, nil, nil},
+		{"added and removed", []string{"a", "b", "c"}, []string{"b", "c", "d"}, []string{"d"}, []string{"a"}},
+		{"from empty", nil, []string{"x", "y"}, []string{"x", "y"}, nil},
+		{"to empty", []string{"x", "y"}, nil, nil, []string{"x", "y"}},
+		{"duplicates matched one for one", []string{"a", "a", "b"}, []string{"a", "b", "b"}, []string{"b"}, []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := Diff(tt.a, tt.b)
+			if !reflect.DeepEqual(added, tt.added) || !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("Diff(%v, %v) = added %v, removed %v; want %v, %v",
+					tt.a, tt.b, added, removed, tt.added, tt.removed)
+			}
+		})
+	}
+}
@@ -9,6 +9,15 @@ import (
 // This file covers all types of loops in Go
 // Go has only one loop construct: the for loop (but it's very versatile)
 
+// RandSource is the randomness the simulations below depend on. Swap rng
+// for a seeded source, e.g. rand.New(rand.NewSource(42)), to get the same
+// outcomes on every run.
+type RandSource interface {
+	Intn(n int) int
+}
+
+var rng RandSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+
 func main() {
 	fmt.Println("=== GO LOOPS - COMPLETE GUIDE ===")
 
@@ -124,7 +133,7 @@ func demonstrateWhileStyleLoop() {
 		fmt.Printf("Attempt %d: ", attempts)
 
 		// Simulate random success/failure
-		if rand.Intn(2) == 1 {
+		if rng.Intn(2) == 1 {
 			fmt.Println("Success!")
 			success = true
 		} else {
@@ -211,7 +220,7 @@ func demonstrateInfiniteLoop() {
 	fmt.Println("Infinite loop with multiple break conditions:")
 	value := 0
 	for {
-		value += rand.Intn(10) + 1
+		value += rng.Intn(10) + 1
 		fmt.Printf("Current value: %d\n", value)
 
 		if value > 20 {
@@ -772,6 +772,20 @@ func demonstrateSwitchBestPractices() {
 		fmt.Println("Available commands: start, stop, restart")
 	}
 
+	// The same dispatch modeled as data instead of code
+	commands := NewDispatcher[string]()
+	commands.Register("start", func() { fmt.Println("Starting service") })
+	commands.Register("stop", func() { fmt.Println("Stopping service") })
+	commands.Register("restart", func() { fmt.Println("Restarting service") })
+	commands.Default(func() { fmt.Printf("Unknown command: %s\n", command) })
+
+	for _, cmd := range []string{"start", "restart"} {
+		commands.Dispatch(cmd)
+	}
+	if !commands.Dispatch(command) {
+		fmt.Println("(handled by default)")
+	}
+
 	// 5. Use switch with initializer when appropriate
 	fmt.Println("\n5. Use switch with initializer:")
 
@@ -942,3 +956,35 @@ func isValidEmail(email string) bool {
 		return hasAt
 	}
 }
+
+// Dispatcher maps keys to handlers, like a switch without fallthrough.
+// Registering the same key again replaces the previous handler.
+type Dispatcher[K comparable] struct {
+	handlers map[K]func()
+	fallback func()
+}
+
+func NewDispatcher[K comparable]() *Dispatcher[K] {
+	return &Dispatcher[K]{handlers: make(map[K]func())}
+}
+
+func (d *Dispatcher[K]) Register(key K, fn func()) {
+	d.handlers[key] = fn
+}
+
+func (d *Dispatcher[K]) Default(fn func()) {
+	d.fallback = fn
+}
+
+// Dispatch runs the handler for key, or the default handler if none matches.
+// It reports whether a registered (non-default) handler ran.
+func (d *Dispatcher[K]) Dispatch(key K) bool {
+	if fn, ok := d.handlers[key]; ok {
+		fn()
+		return true
+	}
+	if d.fallback != nil {
+		d.fallback()
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+// === DISPATCHER ===
+
+func TestDispatchRunsRegisteredHandler(t *testing.T) {
+	d := NewDispatcher[string]()
+	var ran []string
+	d.Register("start", func() { ran = append(ran, "start") })
+	d.Register("stop", func() { ran = append(ran, "stop") })
+	d.Default(func() { ran = append(ran, "default") })
+
+	if !d.Dispatch("stop") {
+		t.Error("Dispatch(stop) = false, want true for a registered key")
+	}
+	if len(ran) != 1 || ran[0] != "stop" {
+		t.Errorf("ran %v, want only stop", ran)
+	}
+}
+
+func TestDispatchFallsBackToDefault(t *testing.T) {
+	d := NewDispatcher[int]()
+	registered, fallback := 0, 0
+	d.Register(1, func() { registered++ })
+	d.Default(func() { fallback++ })
+
+	if d.Dispatch(2) {
+		t.Error("Dispatch(2) = true, want false when only the default ran")
+	}
+	if registered != 0 || fallback != 1 {
+		t.Errorf("registered ran %d times, default %d; want 0 and 1", registered, fallback)
+	}
+}
+
+func TestDispatchWithoutDefault(t *testing.T) {
+	d := NewDispatcher[string]()
+
+	if d.Dispatch("anything") {
+		t.Error("Dispatch on an empty dispatcher = true, want false")
+	}
+}
+
+func TestRegisterOverwritesPreviousHandler(t *testing.T) {
+	d := NewDispatcher[rune]()
+	var got string
+	d.Register('q', func() { got = "old" })
+	d.Register('q', func() { got = "new" })
+
+	d.Dispatch('q')
+	if got != "new" {
+		t.Errorf("ran %q handler, want the re-registered one", got)
+	}
+
+	// Default can be replaced the same way
+	d.Default(func() { got = "old default" })
+	d.Default(func() { got = "new default" })
+	d.Dispatch('x')
+	if got != "new default" {
+		t.Errorf("ran %q, want the latest default", got)
+	}
+}
@@ -347,6 +347,22 @@ func main() {
 	fmt.Printf("Set B: %v\n", getKeys(setB))
 	fmt.Printf("Set intersection: %v\n", getKeys(setIntersection))
 
+	// De-duplication: a set tracks which values were already seen
+	tags := []string{"go", "web", "go", "api", "web", "go"}
+	fmt.Printf("Dedup %v: %v\n", tags, Dedup(tags))
+
+	type contact struct {
+		Name  string
+		Email string
+	}
+	contacts := []contact{
+		{"Alice", "alice@example.com"},
+		{"Bob", "bob@example.com"},
+		{"Alice B.", "alice@example.com"},
+	}
+	uniqueContacts := DedupFunc(contacts, func(c contact) string { return c.Email })
+	fmt.Printf("Contacts unique by email: %v\n", uniqueContacts)
+
 	// === MAP PERFORMANCE ===
 	fmt.Println("\n--- MAP PERFORMANCE ---")
 
@@ -487,3 +503,23 @@ func getKeys(set map[string]struct{}) []string {
 	}
 	return keys
 }
+
+// Dedup returns the unique values of in, keeping first occurrences in order
+func Dedup[T comparable](in []T) []T {
+	return DedupFunc(in, func(v T) T { return v })
+}
+
+// DedupFunc removes elements whose key was already seen, keeping first occurrences
+func DedupFunc[T any, K comparable](in []T, key func(T) K) []T {
+	seen := make(map[K]struct{}, len(in))
+	result := make([]T, 0, len(in))
+	for _, v := range in {
+		k := key(v)
+		if _, exists := seen[k]; exists {
+			continue
+		}
+		seen[k] = struct{}{}
+		result = append(result, v)
+	}
+	return result
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// === DEDUP ===
+
+func TestDedup(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []int
+		want []int
+	}{
+		{"duplicates keep first occurrence", []int{3, 1, 3, 2, 1, 3}, []int{3, 1, 2}},
+		{"all unique unchanged", []int{5, 4, 3}, []int{5, 4, 3}},
+		{"all the same", []int{7, 7, 7}, []int{7}},
+		{"empty", []int{}, []int{}},
+		{"nil", nil, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Dedup(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dedup(%v) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupDoesNotModifyInput(t *testing.T) {
+	in := []string{"b", "a", "b"}
+	Dedup(in)
+	if want := []string{"b", "a", "b"}; !reflect.DeepEqual(in, want) {
+		t.Errorf("input changed to %v", in)
+	}
+}
+
+func TestDedupFuncByField(t *testing.T) {
+	type user struct {
+		Email string
+		Name  string
+	}
+	in := []user{
+		{"a@example.com", "Alice"},
+		{"b@example.com", "Bob"},
+		{"a@example.com", "Alice again"},
+		{"c@example.com", "Carol"},
+		{"b@example.com", "Bob again"},
+	}
+
+	got := DedupFunc(in, func(u user) string { return u.Email })
+	want := []user{
+		{"a@example.com", "Alice"},
+		{"b@example.com", "Bob"},
+		{"c@example.com", "Carol"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DedupFunc = %v, want %v", got, want)
+	}
+}
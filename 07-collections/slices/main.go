@@ -226,17 +226,19 @@ func main() {
 	}
 
 	// Check if slice contains value
-	contains := func(slice []int, value int) bool {
-		for _, v := range slice {
-			if v == value {
-				return true
-			}
-		}
-		return false
-	}
+	fmt.Printf("Contains 5: %t\n", Contains(values, 5))
+	fmt.Printf("Contains 15: %t\n", Contains(values, 15))
+
+	// Locate values by equality or by predicate
+	fmt.Printf("IndexOf 7: %d\n", IndexOf(values, 7))
+	fmt.Printf("IndexOf 15: %d\n", IndexOf(values, 15))
 
-	fmt.Printf("Contains 5: %t\n", contains(values, 5))
-	fmt.Printf("Contains 15: %t\n", contains(values, 15))
+	if v, i, ok := Find(values, func(n int) bool { return n*n > 50 }); ok {
+		fmt.Printf("First value whose square exceeds 50: %d (index %d)\n", v, i)
+	}
+	if _, _, ok := Find(values, func(n int) bool { return n > 100 }); !ok {
+		fmt.Println("No value greater than 100")
+	}
 
 	// === SLICE SORTING ===
 	fmt.Println("\n--- SLICE SORTING ---")
@@ -274,14 +276,10 @@ func main() {
 
 	numbers10 := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
 
-	// Filter even numbers
-	var evens []int
-	for _, n := range numbers10 {
-		if n%2 == 0 {
-			evens = append(evens, n)
-		}
-	}
+	// Split into evens and odds in a single pass
+	evens, odds := Partition(numbers10, func(n int) bool { return n%2 == 0 })
 	fmt.Printf("Even numbers: %v\n", evens)
+	fmt.Printf("Odd numbers: %v\n", odds)
 
 	// Filter using function
 	filter := func(slice []int, predicate func(int) bool) []int {
@@ -294,8 +292,8 @@ func main() {
 		return result
 	}
 
-	odds := filter(numbers10, func(n int) bool { return n%2 != 0 })
-	fmt.Printf("Odd numbers: %v\n", odds)
+	large := filter(numbers10, func(n int) bool { return n > 5 })
+	fmt.Printf("Numbers greater than 5: %v\n", large)
 
 	// === SLICE MAPPING ===
 	fmt.Println("\n--- SLICE MAPPING ---")
@@ -477,3 +475,39 @@ func main() {
 	fmt.Println("9. Be careful with slice mutations")
 	fmt.Println("10. Use string slicing for substring operations")
 }
+
+// Find returns the first element matching pred along with its index.
+// If none matches it returns the zero value, -1 and false.
+func Find[T any](slice []T, pred func(T) bool) (T, int, bool) {
+	for i, v := range slice {
+		if pred(v) {
+			return v, i, true
+		}
+	}
+	var zero T
+	return zero, -1, false
+}
+
+// IndexOf returns the index of the first element equal to value, or -1
+func IndexOf[T comparable](slice []T, value T) int {
+	_, i, _ := Find(slice, func(v T) bool { return v == value })
+	return i
+}
+
+// Contains reports whether value is present in slice
+func Contains[T comparable](slice []T, value T) bool {
+	return IndexOf(slice, value) >= 0
+}
+
+// Partition splits in into the elements matching pred and the rest,
+// in one pass and preserving the original order of both
+func Partition[T any](in []T, pred func(T) bool) (matched, rest []T) {
+	for _, v := range in {
+		if pred(v) {
+			matched = append(matched, v)
+		} else {
+			rest = append(rest, v)
+		}
+	}
+	return matched, rest
+}
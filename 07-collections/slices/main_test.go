@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// === SEARCH ===
+
+func TestFindReturnsFirstMatch(t *testing.T) {
+	numbers := []int{1, 4, 7, 8, 10}
+
+	v, i, ok := Find(numbers, func(n int) bool { return n%2 == 0 })
+	if !ok || v != 4 || i != 1 {
+		t.Errorf("Find(even) = %d, %d, %t; want 4, 1, true", v, i, ok)
+	}
+}
+
+func TestFindNotFound(t *testing.T) {
+	type user struct{ Name string }
+	users := []user{{"alice"}, {"bob"}}
+
+	v, i, ok := Find(users, func(u user) bool { return u.Name == "carol" })
+	if ok || i != -1 || v != (user{}) {
+		t.Errorf("Find(carol) = %+v, %d, %t; want zero value, -1, false", v, i, ok)
+	}
+}
+
+func TestFindEmpty(t *testing.T) {
+	called := false
+	v, i, ok := Find([]string(nil), func(string) bool { called = true; return true })
+	if ok || i != -1 || v != "" || called {
+		t.Errorf("Find on nil = %q, %d, %t (pred called %t); want \"\", -1, false", v, i, ok, called)
+	}
+}
+
+func TestIndexOfAndContains(t *testing.T) {
+	fruits := []string{"apple", "banana", "cherry", "banana"}
+
+	tests := []struct {
+		value    string
+		index    int
+		contains bool
+	}{
+		{"apple", 0, true},
+		{"banana", 1, true}, // first occurrence wins
+		{"cherry", 2, true},
+		{"durian", -1, false},
+		{"", -1, false},
+	}
+
+	for _, tt := range tests {
+		if got := IndexOf(fruits, tt.value); got != tt.index {
+			t.Errorf("IndexOf(%q) = %d, want %d", tt.value, got, tt.index)
+		}
+		if got := Contains(fruits, tt.value); got != tt.contains {
+			t.Errorf("Contains(%q) = %t, want %t", tt.value, got, tt.contains)
+		}
+	}
+
+	if IndexOf([]int{}, 0) != -1 || Contains([]int(nil), 0) {
+		t.Error("empty slices should report not found")
+	}
+}
+
+// === PARTITION ===
+
+func TestPartition(t *testing.T) {
+	isEven := func(n int) bool { return n%2 == 0 }
+
+	tests := []struct {
+		name          string
+		in            []int
+		matched, rest []int
+	}{
+		{"mixed keeps order", []int{1, 2, 3, 4, 5, 6}, []int{2, 4, 6}, []int{1, 3, 5}},
+		{"all match", []int{8, 2, 4}, []int{8, 2, 4}, nil},
+		{"none match", []int{7, 3, 9}, nil, []int{7, 3, 9}},
+		{"empty", []int{}, nil, nil},
+		{"nil", nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, rest := Partition(tt.in, isEven)
+			if !reflect.DeepEqual(matched, tt.matched) || !reflect.DeepEqual(rest, tt.rest) {
+				t.Errorf("Partition(%v) = %v, %v; want %v, %v", tt.in, matched, rest, tt.matched, tt.rest)
+			}
+		})
+	}
+}
+
+func TestPartitionCallsPredOncePerElement(t *testing.T) {
+	calls := 0
+	Partition([]string{"a", "bb", "ccc"}, func(s string) bool {
+		calls++
+		return len(s) > 1
+	})
+	if calls != 3 {
+		t.Errorf("pred called %d times, want 3 (one pass)", calls)
+	}
+}
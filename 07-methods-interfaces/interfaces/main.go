@@ -1,11 +1,15 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
 	"io"
 	"math"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // === INTERFACES IN GO ===
@@ -152,35 +156,63 @@ func DrawShapes(shapes []DrawableShape) {
 	}
 }
 
-// 9. Interface for sorting
+// 9. Sorting without sort.Interface boilerplate
 type Person struct {
 	Name string
 	Age  int
 }
 
-type People []Person
-
-func (p People) Len() int {
-	return len(p)
+// SortBy sorts s in place using less; the order of equal elements may change
+func SortBy[T any](s []T, less func(a, b T) bool) {
+	sort.Slice(s, func(i, j int) bool { return less(s[i], s[j]) })
 }
 
-func (p People) Less(i, j int) bool {
-	return p[i].Age < p[j].Age
+// SortStable sorts s in place using less, keeping equal elements in their
+// original order
+func SortStable[T any](s []T, less func(a, b T) bool) {
+	sort.SliceStable(s, func(i, j int) bool { return less(s[i], s[j]) })
 }
 
-func (p People) Swap(i, j int) {
-	p[i], p[j] = p[j], p[i]
+// SortByKey stably sorts s in ascending order of key
+func SortByKey[T any, K cmp.Ordered](s []T, key func(T) K) {
+	SortStable(s, func(a, b T) bool { return key(a) < key(b) })
 }
 
 // 10. Custom interface for business logic
 type PaymentProcessor interface {
 	ProcessPayment(amount float64) error
 	GetTransactionFee() float64
+	CalculateFee(amount float64) float64
+}
+
+// RoundingMode controls how fees are rounded to whole cents
+type RoundingMode int
+
+const (
+	RoundHalfUp   RoundingMode = iota // 0.005 -> 0.01
+	RoundHalfEven                     // bankers' rounding: 0.005 -> 0.00, 0.015 -> 0.02
+)
+
+// calculateFee centralizes monetary math: amount * rate% rounded to cents
+func calculateFee(amount, feeRate float64, mode RoundingMode) float64 {
+	cents := amount * feeRate // amount * feeRate / 100 * 100
+	// Strip float noise (e.g. 0.49999999999) before deciding which way to round
+	cents = math.Round(cents*1e6) / 1e6
+
+	switch mode {
+	case RoundHalfEven:
+		cents = math.RoundToEven(cents)
+	default:
+		cents = math.Floor(cents + 0.5)
+	}
+
+	return cents / 100
 }
 
 type CreditCardProcessor struct {
 	CardNumber string
 	FeeRate    float64
+	Rounding   RoundingMode
 }
 
 func (ccp CreditCardProcessor) ProcessPayment(amount float64) error {
@@ -192,9 +224,14 @@ func (ccp CreditCardProcessor) GetTransactionFee() float64 {
 	return ccp.FeeRate
 }
 
+func (ccp CreditCardProcessor) CalculateFee(amount float64) float64 {
+	return calculateFee(amount, ccp.FeeRate, ccp.Rounding)
+}
+
 type PayPalProcessor struct {
-	Email   string
-	FeeRate float64
+	Email    string
+	FeeRate  float64
+	Rounding RoundingMode
 }
 
 func (pp PayPalProcessor) ProcessPayment(amount float64) error {
@@ -206,6 +243,10 @@ func (pp PayPalProcessor) GetTransactionFee() float64 {
 	return pp.FeeRate
 }
 
+func (pp PayPalProcessor) CalculateFee(amount float64) float64 {
+	return calculateFee(amount, pp.FeeRate, pp.Rounding)
+}
+
 // 11. Interface for database operations
 type Repository interface {
 	Save(entity interface{}) error
@@ -262,8 +303,7 @@ type Observer interface {
 }
 
 type Subject interface {
-	Subscribe(observer Observer)
-	Unsubscribe(observer Observer)
+	Subscribe(observer Observer) *Subscription
 	Notify(message string)
 }
 
@@ -284,25 +324,37 @@ func (so SMSObserver) Update(message string) {
 }
 
 type NewsPublisher struct {
-	observers []Observer
+	subscriptions []*Subscription
+}
+
+// Subscription is the handle returned by Subscribe.
+// Each call to Subscribe gets its own handle, so the same observer can be
+// registered twice and each registration removed independently.
+type Subscription struct {
+	publisher *NewsPublisher
+	observer  Observer
 }
 
-func (np *NewsPublisher) Subscribe(observer Observer) {
-	np.observers = append(np.observers, observer)
+func (np *NewsPublisher) Subscribe(observer Observer) *Subscription {
+	sub := &Subscription{publisher: np, observer: observer}
+	np.subscriptions = append(np.subscriptions, sub)
+	return sub
 }
 
-func (np *NewsPublisher) Unsubscribe(observer Observer) {
-	for i, obs := range np.observers {
-		if obs == observer {
-			np.observers = append(np.observers[:i], np.observers[i+1:]...)
-			break
+// Unsubscribe removes exactly this registration; calling it twice is a no-op
+func (s *Subscription) Unsubscribe() {
+	np := s.publisher
+	for i, sub := range np.subscriptions {
+		if sub == s { // pointer identity, works for non-comparable observers
+			np.subscriptions = append(np.subscriptions[:i], np.subscriptions[i+1:]...)
+			return
 		}
 	}
 }
 
 func (np *NewsPublisher) Notify(message string) {
-	for _, observer := range np.observers {
-		observer.Update(message)
+	for _, sub := range np.subscriptions {
+		sub.observer.Update(message)
 	}
 }
 
@@ -529,6 +581,128 @@ func (mc MapConfig) GetBool(key string) bool {
 	return false
 }
 
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Bind populates the struct pointed to by out from the config, matching
+// fields by their json tag (or field name). Keys missing from the config
+// leave the field untouched; values that can't be converted are an error.
+func Bind[T any](mc MapConfig, out *T) error {
+	v := reflect.ValueOf(out).Elem()
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("bind: %T is not a struct", *out)
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		key := field.Name
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag == "-" {
+			continue
+		} else if tag != "" {
+			key = tag
+		}
+
+		raw, exists := mc.data[key]
+		if !exists {
+			continue
+		}
+
+		if err := setConfigValue(v.Field(i), raw); err != nil {
+			return fmt.Errorf("bind: key %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// setConfigValue converts raw into the field's type and assigns it
+func setConfigValue(field reflect.Value, raw interface{}) error {
+	mismatch := fmt.Errorf("cannot use %T value %v as %s", raw, raw, field.Type())
+
+	// Durations accept "30s"-style strings as well as plain integers
+	if field.Type() == durationType {
+		if str, ok := raw.(string); ok {
+			d, err := time.ParseDuration(str)
+			if err != nil {
+				return mismatch
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		str, ok := raw.(string)
+		if !ok {
+			return mismatch
+		}
+		field.SetString(str)
+
+	case reflect.Bool:
+		switch b := raw.(type) {
+		case bool:
+			field.SetBool(b)
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			if err != nil {
+				return mismatch
+			}
+			field.SetBool(parsed)
+		default:
+			return mismatch
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		rv := reflect.ValueOf(raw)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = rv.Int()
+		case reflect.Float32, reflect.Float64:
+			f := rv.Float()
+			if f != math.Trunc(f) {
+				return mismatch
+			}
+			n = int64(f)
+		case reflect.String:
+			parsed, err := strconv.ParseInt(rv.String(), 10, 64)
+			if err != nil {
+				return mismatch
+			}
+			n = parsed
+		default:
+			return mismatch
+		}
+		if field.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %s", n, field.Type())
+		}
+		field.SetInt(n)
+
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		rv := reflect.ValueOf(raw)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(rv.Int())
+		case reflect.Float32, reflect.Float64:
+			f = rv.Float()
+		default:
+			return mismatch
+		}
+		field.SetFloat(f)
+
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
+
 func main() {
 	fmt.Println("=== GO INTERFACES COMPREHENSIVE GUIDE ===")
 
@@ -631,19 +805,28 @@ func main() {
 		fmt.Printf("Read %d bytes: %s\n", n, string(readData[:n]))
 	}
 
-	// === SORTING INTERFACE ===
-	fmt.Println("\n--- SORTING INTERFACE ---")
-	people := People{
+	// === SORTING ===
+	fmt.Println("\n--- SORTING ---")
+	people := []Person{
 		{"Alice", 30},
 		{"Bob", 25},
 		{"Charlie", 35},
 		{"Diana", 28},
+		{"Eve", 30},
 	}
 
 	fmt.Printf("Before sorting: %v\n", people)
-	sort.Sort(people)
+	SortByKey(people, func(p Person) int { return p.Age })
 	fmt.Printf("After sorting by age: %v\n", people)
 
+	SortBy(people, func(a, b Person) bool { return a.Age > b.Age })
+	fmt.Printf("Oldest first: %v\n", people)
+
+	// Stable: Alice and Eve (both 30) keep their alphabetical order
+	SortByKey(people, func(p Person) string { return p.Name })
+	SortStable(people, func(a, b Person) bool { return a.Age < b.Age })
+	fmt.Printf("By age, then name: %v\n", people)
+
 	// === PAYMENT PROCESSOR ===
 	fmt.Println("\n--- PAYMENT PROCESSOR ---")
 	processors := []PaymentProcessor{
@@ -654,12 +837,20 @@ func main() {
 	amount := 100.0
 	for _, processor := range processors {
 		processor.ProcessPayment(amount)
-		fee := processor.GetTransactionFee()
-		fmt.Printf("Transaction fee: %.2f%%\n", fee)
-		fmt.Printf("Total cost: $%.2f\n", amount+amount*fee/100)
+		fee := processor.CalculateFee(amount)
+		fmt.Printf("Transaction fee: %.2f%% ($%.2f)\n", processor.GetTransactionFee(), fee)
+		fmt.Printf("Total cost: $%.2f\n", amount+fee)
 		fmt.Println()
 	}
 
+	// Rounding modes only differ on exact half cents
+	halfUp := CreditCardProcessor{FeeRate: 1, Rounding: RoundHalfUp}
+	bankers := CreditCardProcessor{FeeRate: 1, Rounding: RoundHalfEven}
+	for _, amt := range []float64{0.5, 1.5, 2.5} {
+		fmt.Printf("1%% of $%.2f: half-up $%.2f, bankers' $%.2f\n",
+			amt, halfUp.CalculateFee(amt), bankers.CalculateFee(amt))
+	}
+
 	// === REPOSITORY PATTERN ===
 	fmt.Println("\n--- REPOSITORY PATTERN ---")
 	repo := NewMemoryRepository()
@@ -680,10 +871,14 @@ func main() {
 	smsObs := SMSObserver{Phone: "+1234567890"}
 
 	publisher.Subscribe(emailObs)
-	publisher.Subscribe(smsObs)
+	smsSub := publisher.Subscribe(smsObs)
 
 	publisher.Notify("Breaking news: Go interfaces are awesome!")
 
+	// Unsubscribe through the handle returned by Subscribe
+	smsSub.Unsubscribe()
+	publisher.Notify("Only email subscribers see this one")
+
 	// === STRATEGY PATTERN ===
 	fmt.Println("\n--- STRATEGY PATTERN ---")
 	cart := &ShoppingCart{
@@ -758,6 +953,7 @@ func main() {
 			"port":            8080,
 			"debug":           true,
 			"max_connections": 100,
+			"read_timeout":    "30s",
 		},
 	}
 
@@ -766,6 +962,27 @@ func main() {
 	fmt.Printf("Debug mode: %t\n", config.GetBool("debug"))
 	fmt.Printf("Max connections: %d\n", config.GetInt("max_connections"))
 
+	// Bind the loose map into a typed struct in one step
+	type ServerSettings struct {
+		AppName        string        `json:"app_name"`
+		Port           int           `json:"port"`
+		Debug          bool          `json:"debug"`
+		MaxConnections int           `json:"max_connections"`
+		ReadTimeout    time.Duration `json:"read_timeout"`
+	}
+
+	settings := ServerSettings{ReadTimeout: 5 * time.Second}
+	if err := Bind(config, &settings); err != nil {
+		fmt.Printf("Bind error: %v\n", err)
+	} else {
+		fmt.Printf("Bound settings: %+v\n", settings)
+	}
+
+	badConfig := MapConfig{data: map[string]interface{}{"port": "not-a-number"}}
+	if err := Bind(badConfig, &settings); err != nil {
+		fmt.Printf("Bind error: %v\n", err)
+	}
+
 	// === INTERFACE BEST PRACTICES ===
 	fmt.Println("\n--- INTERFACE BEST PRACTICES ---")
 	fmt.Println("1. Keep interfaces small and focused")
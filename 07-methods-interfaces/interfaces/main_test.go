@@ -0,0 +1,290 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// === OBSERVERS ===
+
+// recordingObserver is deliberately non-comparable (it holds a slice), so
+// == on it would panic
+type recordingObserver struct {
+	messages *[]string
+	tags     []string
+}
+
+func (ro recordingObserver) Update(message string) {
+	*ro.messages = append(*ro.messages, message)
+}
+
+func newRecordingObserver() (recordingObserver, *[]string) {
+	var messages []string
+	return recordingObserver{messages: &messages, tags: []string{"test"}}, &messages
+}
+
+func TestUnsubscribeRemovesOnlyThatRegistration(t *testing.T) {
+	publisher := &NewsPublisher{}
+	observer, got := newRecordingObserver()
+
+	first := publisher.Subscribe(observer)
+	publisher.Subscribe(observer)
+	publisher.Notify("both")
+
+	first.Unsubscribe()
+	publisher.Notify("one left")
+
+	if want := []string{"both", "both", "one left"}; !reflect.DeepEqual(*got, want) {
+		t.Errorf("messages = %v, want %v", *got, want)
+	}
+}
+
+func TestUnsubscribeTwiceIsNoOp(t *testing.T) {
+	publisher := &NewsPublisher{}
+	a, gotA := newRecordingObserver()
+	b, gotB := newRecordingObserver()
+
+	subA := publisher.Subscribe(a)
+	publisher.Subscribe(b)
+	subA.Unsubscribe()
+	subA.Unsubscribe()
+	publisher.Notify("hello")
+
+	if len(*gotA) != 0 {
+		t.Errorf("unsubscribed observer got %v", *gotA)
+	}
+	if len(*gotB) != 1 {
+		t.Errorf("remaining observer got %v, want one message", *gotB)
+	}
+}
+
+func TestUnsubscribeKeepsOthersInOrder(t *testing.T) {
+	publisher := &NewsPublisher{}
+	var order []string
+	subs := make([]*Subscription, 3)
+	for i, name := range []string{"a", "b", "c"} {
+		subs[i] = publisher.Subscribe(observerFunc(func(string) { order = append(order, name) }))
+	}
+
+	subs[1].Unsubscribe()
+	publisher.Notify("hi")
+
+	if len(order) != 2 || order[0] != "a" || order[1] != "c" {
+		t.Errorf("notified %v, want [a c]", order)
+	}
+}
+
+// observerFunc adapts a function to Observer; funcs aren't comparable either
+type observerFunc func(message string)
+
+func (f observerFunc) Update(message string) { f(message) }
+
+// === FEES ===
+
+func TestCalculateFeeRoundingModes(t *testing.T) {
+	tests := []struct {
+		name           string
+		amount, rate   float64
+		halfUp, halfEv float64
+	}{
+		{"half a cent rounds up or to even zero", 0.5, 1, 0.01, 0.00},
+		{"1.5 cents rounds to 2 either way", 1.5, 1, 0.02, 0.02},
+		{"2.5 cents splits the modes", 2.5, 1, 0.03, 0.02},
+		{"float noise just below a half", 1.15, 10, 0.12, 0.12},
+		{"exact half at 12.5 cents", 1.25, 10, 0.13, 0.12},
+		{"whole cents stay put", 100, 2.9, 2.90, 2.90},
+		{"above half rounds up", 33.33, 2.9, 0.97, 0.97},
+		{"zero amount", 0, 2.9, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calculateFee(tt.amount, tt.rate, RoundHalfUp); got != tt.halfUp {
+				t.Errorf("half-up fee on %v at %v%% = %v, want %v", tt.amount, tt.rate, got, tt.halfUp)
+			}
+			if got := calculateFee(tt.amount, tt.rate, RoundHalfEven); got != tt.halfEv {
+				t.Errorf("half-even fee on %v at %v%% = %v, want %v", tt.amount, tt.rate, got, tt.halfEv)
+			}
+		})
+	}
+}
+
+func TestProcessorsUseTheirRoundingMode(t *testing.T) {
+	processors := []struct {
+		processor PaymentProcessor
+		want      float64
+	}{
+		{CreditCardProcessor{FeeRate: 1, Rounding: RoundHalfUp}, 0.03},
+		{CreditCardProcessor{FeeRate: 1, Rounding: RoundHalfEven}, 0.02},
+		{PayPalProcessor{FeeRate: 1, Rounding: RoundHalfUp}, 0.03},
+		{PayPalProcessor{FeeRate: 1, Rounding: RoundHalfEven}, 0.02},
+	}
+
+	for _, p := range processors {
+		if got := p.processor.CalculateFee(2.5); got != p.want {
+			t.Errorf("%T(%+v).CalculateFee(2.5) = %v, want %v", p.processor, p.processor, got, p.want)
+		}
+	}
+}
+
+// === CONFIG BINDING ===
+
+type serverSettings struct {
+	Host    string        `json:"host"`
+	Port    int           `json:"port"`
+	Debug   bool          `json:"debug"`
+	Timeout time.Duration `json:"timeout"`
+	Region  string        // no tag: matched by field name
+	Secret  string        `json:"-"`
+}
+
+func TestBindPopulatesFieldsByTag(t *testing.T) {
+	mc := MapConfig{data: map[string]interface{}{
+		"host":    "localhost",
+		"port":    8080,
+		"debug":   true,
+		"timeout": "30s",
+		"Region":  "eu-west",
+		"Secret":  "should be ignored",
+	}}
+
+	var got serverSettings
+	if err := Bind(mc, &got); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	want := serverSettings{Host: "localhost", Port: 8080, Debug: true, Timeout: 30 * time.Second, Region: "eu-west"}
+	if got != want {
+		t.Errorf("Bind = %+v, want %+v", got, want)
+	}
+}
+
+func TestBindConvertsLooseValues(t *testing.T) {
+	// JSON-decoded numbers are float64, and env-style values are strings
+	mc := MapConfig{data: map[string]interface{}{
+		"port":    float64(9090),
+		"debug":   "true",
+		"timeout": 5,
+	}}
+
+	var got serverSettings
+	if err := Bind(mc, &got); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if got.Port != 9090 || !got.Debug || got.Timeout != 5 {
+		t.Errorf("Bind = %+v, want port 9090, debug true, timeout 5ns", got)
+	}
+}
+
+func TestBindLeavesMissingKeysUntouched(t *testing.T) {
+	got := serverSettings{Host: "default", Port: 80}
+	if err := Bind(MapConfig{data: map[string]interface{}{"port": 81}}, &got); err != nil {
+		t.Fatalf("Bind: %v", err)
+	}
+	if got.Host != "default" || got.Port != 81 {
+		t.Errorf("Bind = %+v, want host kept and port 81", got)
+	}
+}
+
+func TestBindTypeMismatch(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		key  string
+	}{
+		{"string into int", map[string]interface{}{"port": "not-a-number"}, "port"},
+		{"fractional float into int", map[string]interface{}{"port": 80.5}, "port"},
+		{"int into string", map[string]interface{}{"host": 42}, "host"},
+		{"bad bool", map[string]interface{}{"debug": "maybe"}, "debug"},
+		{"bad duration", map[string]interface{}{"timeout": "soon"}, "timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got serverSettings
+			err := Bind(MapConfig{data: tt.data}, &got)
+			if err == nil {
+				t.Fatalf("Bind succeeded with %+v, want an error", got)
+			}
+			if !strings.Contains(err.Error(), `"`+tt.key+`"`) {
+				t.Errorf("error %q doesn't name key %q", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestBindRejectsNonStruct(t *testing.T) {
+	var n int
+	if err := Bind(MapConfig{data: map[string]interface{}{}}, &n); err == nil {
+		t.Error("Bind into *int succeeded, want an error")
+	}
+}
+
+// === SORTING ===
+
+func names(people []Person) []string {
+	result := make([]string, len(people))
+	for i, p := range people {
+		result[i] = p.Name
+	}
+	return result
+}
+
+func samplePeople() []Person {
+	return []Person{
+		{"Alice", 30},
+		{"Bob", 25},
+		{"Charlie", 35},
+		{"Diana", 25},
+		{"Eve", 30},
+	}
+}
+
+func TestSortByAscendingAndDescending(t *testing.T) {
+	people := samplePeople()
+	SortBy(people, func(a, b Person) bool { return a.Name > b.Name })
+	if want := []string{"Eve", "Diana", "Charlie", "Bob", "Alice"}; !reflect.DeepEqual(names(people), want) {
+		t.Errorf("descending by name = %v, want %v", names(people), want)
+	}
+
+	SortBy(people, func(a, b Person) bool { return a.Name < b.Name })
+	if want := []string{"Alice", "Bob", "Charlie", "Diana", "Eve"}; !reflect.DeepEqual(names(people), want) {
+		t.Errorf("ascending by name = %v, want %v", names(people), want)
+	}
+}
+
+func TestSortStableKeepsEqualElementsInOrder(t *testing.T) {
+	people := samplePeople()
+	SortStable(people, func(a, b Person) bool { return a.Age > b.Age })
+
+	// Ties keep their input order: Alice before Eve, Bob before Diana
+	if want := []string{"Charlie", "Alice", "Eve", "Bob", "Diana"}; !reflect.DeepEqual(names(people), want) {
+		t.Errorf("stable descending by age = %v, want %v", names(people), want)
+	}
+}
+
+func TestSortByKeyIsStableAndAscending(t *testing.T) {
+	people := samplePeople()
+	SortByKey(people, func(p Person) int { return p.Age })
+
+	if want := []string{"Bob", "Diana", "Alice", "Eve", "Charlie"}; !reflect.DeepEqual(names(people), want) {
+		t.Errorf("by age = %v, want %v", names(people), want)
+	}
+
+	// Sorting by a second key afterwards keeps the first as a tie-breaker
+	SortByKey(people, func(p Person) int { return len(p.Name) })
+	if want := []string{"Bob", "Eve", "Diana", "Alice", "Charlie"}; !reflect.DeepEqual(names(people), want) {
+		t.Errorf("by name length then age = %v, want %v", names(people), want)
+	}
+}
+
+func TestSortHelpersHandleEmpty(t *testing.T) {
+	var empty []Person
+	SortBy(empty, func(a, b Person) bool { return a.Age < b.Age })
+	SortStable(empty, func(a, b Person) bool { return a.Age < b.Age })
+	SortByKey(empty, func(p Person) string { return p.Name })
+	if len(empty) != 0 {
+		t.Errorf("empty slice became %v", empty)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -91,14 +92,14 @@ type Serializable interface {
 }
 
 type Config struct {
-	AppName     string          `json:"app_name"`
-	Version     string          `json:"version"`
-	Debug       bool            `json:"debug"`
-	Database    DatabaseConfig  `json:"database"`
-	Server      ServerConfig    `json:"server"`
-	Features    map[string]bool `json:"features"`
-	Limits      map[string]int  `json:"limits"`
-	Environment string          `json:"environment"`
+	AppName     string                    `json:"app_name"`
+	Version     string                    `json:"version"`
+	Debug       bool                      `json:"debug"`
+	Database    DatabaseConfig            `json:"database"`
+	Server      ServerConfig              `json:"server"`
+	Features    *OrderedMap[string, bool] `json:"features"`
+	Limits      map[string]int            `json:"limits"`
+	Environment string                    `json:"environment"`
 }
 
 type DatabaseConfig struct {
@@ -346,6 +347,115 @@ type Event struct {
 	Location    string   `json:"location"`
 }
 
+// 11. Generic ordered map with deterministic JSON
+type OrderedMap[K comparable, V any] struct {
+	keys   []K
+	values map[K]V
+}
+
+func NewOrderedMap[K comparable, V any]() *OrderedMap[K, V] {
+	return &OrderedMap[K, V]{values: make(map[K]V)}
+}
+
+// Set inserts or updates a key; updates keep the original position
+func (om *OrderedMap[K, V]) Set(key K, value V) {
+	if om.values == nil {
+		om.values = make(map[K]V)
+	}
+	if _, exists := om.values[key]; !exists {
+		om.keys = append(om.keys, key)
+	}
+	om.values[key] = value
+}
+
+func (om *OrderedMap[K, V]) Get(key K) (V, bool) {
+	value, exists := om.values[key]
+	return value, exists
+}
+
+// Keys returns the keys in insertion order
+func (om *OrderedMap[K, V]) Keys() []K {
+	keys := make([]K, len(om.keys))
+	copy(keys, om.keys)
+	return keys
+}
+
+func (om *OrderedMap[K, V]) Len() int {
+	return len(om.keys)
+}
+
+func (om *OrderedMap[K, V]) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range om.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		keyJSON, err := json.Marshal(fmt.Sprint(key))
+		if err != nil {
+			return nil, err
+		}
+		valueJSON, err := json.Marshal(om.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(keyJSON)
+		buf.WriteByte(':')
+		buf.Write(valueJSON)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (om *OrderedMap[K, V]) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("ordered map: expected object, got %v", tok)
+	}
+
+	om.keys = nil
+	om.values = make(map[K]V)
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, err := parseOrderedMapKey[K](tok.(string))
+		if err != nil {
+			return err
+		}
+
+		var value V
+		if err := dec.Decode(&value); err != nil {
+			return err
+		}
+		om.Set(key, value)
+	}
+
+	_, err = dec.Token() // closing '}'
+	return err
+}
+
+// parseOrderedMapKey converts a JSON object key back into K, accepting
+// both string keys and numeric/bool keys written via fmt.Sprint
+func parseOrderedMapKey[K comparable](raw string) (K, error) {
+	var key K
+	quoted, _ := json.Marshal(raw)
+	if err := json.Unmarshal(quoted, &key); err == nil {
+		return key, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &key); err != nil {
+		return key, fmt.Errorf("ordered map: invalid key %q: %w", raw, err)
+	}
+	return key, nil
+}
+
 func main() {
 	fmt.Println("=== ADVANCED STRUCT CONCEPTS ===")
 
@@ -455,22 +565,28 @@ func main() {
 			Port:    8080,
 			Timeout: 30,
 		},
-		Features: map[string]bool{
-			"authentication": true,
-			"logging":        true,
-			"caching":        false,
-		},
+		Features: NewOrderedMap[string, bool](),
 		Limits: map[string]int{
 			"max_connections": 100,
 			"rate_limit":      1000,
 		},
 	}
 
+	config.Features.Set("authentication", true)
+	config.Features.Set("logging", true)
+	config.Features.Set("caching", false)
+
 	configJSON, err := config.ToJSON()
 	if err != nil {
 		fmt.Printf("Error serializing config: %v\n", err)
 	} else {
 		fmt.Printf("Config JSON:\n%s\n", string(configJSON))
+
+		// Features keep their insertion order across a round-trip
+		var restored Config
+		if err := restored.FromJSON(configJSON); err == nil {
+			fmt.Printf("Restored feature order: %v\n", restored.Features.Keys())
+		}
 	}
 
 	// === GENERICS ===
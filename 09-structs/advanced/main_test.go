@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// === ORDERED MAP ===
+
+func TestOrderedMapKeysInInsertionOrder(t *testing.T) {
+	om := NewOrderedMap[string, int]()
+	om.Set("zebra", 1)
+	om.Set("apple", 2)
+	om.Set("mango", 3)
+	om.Set("apple", 20) // update keeps the original position
+
+	if want := []string{"zebra", "apple", "mango"}; !reflect.DeepEqual(om.Keys(), want) {
+		t.Errorf("Keys = %v, want %v", om.Keys(), want)
+	}
+	if v, ok := om.Get("apple"); !ok || v != 20 {
+		t.Errorf("Get(apple) = %d, %t; want 20, true", v, ok)
+	}
+	if _, ok := om.Get("missing"); ok {
+		t.Error("Get(missing) reported a value")
+	}
+}
+
+func TestOrderedMapMarshalsInInsertionOrder(t *testing.T) {
+	om := NewOrderedMap[string, bool]()
+	om.Set("logging", true)
+	om.Set("caching", false)
+	om.Set("authentication", true)
+
+	data, err := json.Marshal(om)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"logging":true,"caching":false,"authentication":true}`; string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+}
+
+func TestOrderedMapRoundTrip(t *testing.T) {
+	om := NewOrderedMap[string, int]()
+	om.Set("c", 3)
+	om.Set("a", 1)
+	om.Set("b", 2)
+
+	data, err := json.Marshal(om)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewOrderedMap[string, int]()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(restored.Keys(), om.Keys()) {
+		t.Errorf("restored keys = %v, want %v", restored.Keys(), om.Keys())
+	}
+	for _, k := range om.Keys() {
+		want, _ := om.Get(k)
+		if got, _ := restored.Get(k); got != want {
+			t.Errorf("restored[%s] = %d, want %d", k, got, want)
+		}
+	}
+}
+
+func TestOrderedMapNonStringKeysRoundTrip(t *testing.T) {
+	om := NewOrderedMap[int, string]()
+	om.Set(10, "ten")
+	om.Set(2, "two")
+
+	data, err := json.Marshal(om)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"10":"ten","2":"two"}`; string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+
+	restored := NewOrderedMap[int, string]()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{10, 2}; !reflect.DeepEqual(restored.Keys(), want) {
+		t.Errorf("restored keys = %v, want %v", restored.Keys(), want)
+	}
+}
+
+func TestOrderedMapUnmarshalRejectsNonObject(t *testing.T) {
+	om := NewOrderedMap[string, int]()
+	if err := json.Unmarshal([]byte(`[1, 2]`), om); err == nil {
+		t.Error("Unmarshal of an array succeeded, want an error")
+	}
+}
+
+func TestConfigFeaturesKeepOrder(t *testing.T) {
+	config := Config{AppName: "app", Features: NewOrderedMap[string, bool]()}
+	config.Features.Set("zeta", true)
+	config.Features.Set("alpha", false)
+
+	data, err := config.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored Config
+	if err := restored.FromJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"zeta", "alpha"}; !reflect.DeepEqual(restored.Features.Keys(), want) {
+		t.Errorf("restored feature keys = %v, want %v", restored.Features.Keys(), want)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -66,15 +67,21 @@ func fanOut(input <-chan int, workers int) []<-chan int {
 }
 
 func fanIn(inputs ...<-chan int) <-chan int {
-	output := make(chan int)
+	return Merge(inputs...)
+}
+
+// Merge fans in any number of channels into one.
+// The output closes once every input channel has been closed.
+func Merge[T any](chans ...<-chan T) <-chan T {
+	output := make(chan T)
 	var wg sync.WaitGroup
 
-	for _, input := range inputs {
+	for _, input := range chans {
 		wg.Add(1)
-		go func(in <-chan int) {
+		go func(in <-chan T) {
 			defer wg.Done()
-			for n := range in {
-				output <- n
+			for v := range in {
+				output <- v
 			}
 		}(input)
 	}
@@ -136,6 +143,36 @@ func contextExample() {
 	}
 }
 
+// WithTimeout runs fn with a deadline of d. If fn doesn't finish in time (or
+// ctx is cancelled first), it returns fallback and an error wrapping
+// context.DeadlineExceeded (or ctx.Err()). fn should honor its ctx; if it
+// doesn't, it keeps running in the background and its result is discarded.
+func WithTimeout[T any](ctx context.Context, d time.Duration, fn func(context.Context) (T, error), fallback T) (T, error) {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1) // buffered so a late fn never blocks forever
+
+	go func() {
+		value, err := fn(ctx)
+		done <- result{value, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fallback, fmt.Errorf("timed out after %v: %w", d, ctx.Err())
+		}
+		return fallback, ctx.Err()
+	}
+}
+
 // Mutex example
 type Counter struct {
 	mu    sync.Mutex
@@ -433,6 +470,18 @@ func main() {
 		fmt.Println("Operation timed out")
 	}
 
+	// The same pattern as a reusable helper with a fallback value
+	price, err := WithTimeout(context.Background(), 100*time.Millisecond,
+		func(ctx context.Context) (float64, error) {
+			select {
+			case <-time.After(time.Second): // slow pricing service
+				return 42.50, nil
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			}
+		}, 40.00)
+	fmt.Printf("Price: %.2f (fallback used: %v)\n", price, err)
+
 	// === SELECT WITH DEFAULT ===
 	fmt.Println("\n--- SELECT WITH DEFAULT ---")
 
@@ -548,6 +597,23 @@ func main() {
 		fmt.Printf("Fan-in result: %d\n", r)
 	}
 
+	// Merge works with any element type, e.g. per-service event streams
+	userEvents := make(chan string, 2)
+	orderEvents := make(chan string, 2)
+	paymentEvents := make(chan string, 1)
+	userEvents <- "user.created"
+	userEvents <- "user.updated"
+	orderEvents <- "order.created"
+	orderEvents <- "order.completed"
+	paymentEvents <- "payment.settled"
+	close(userEvents)
+	close(orderEvents)
+	close(paymentEvents)
+
+	for event := range Merge(userEvents, orderEvents, paymentEvents) {
+		fmt.Printf("Merged event: %s\n", event)
+	}
+
 	// === CONTEXT USAGE ===
 	fmt.Println("\n--- CONTEXT USAGE ---")
 
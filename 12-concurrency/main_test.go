@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// === FAN-IN ===
+
+// send returns a channel that yields values and is then closed
+func send[T any](values ...T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for _, v := range values {
+			ch <- v
+		}
+	}()
+	return ch
+}
+
+func TestMergeDeliversAllValuesAndCloses(t *testing.T) {
+	merged := Merge(send(1, 2, 3), send(10, 20), send(100))
+
+	var got []int
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case v, ok := <-merged:
+			if !ok {
+				sort.Ints(got)
+				if want := []int{1, 2, 3, 10, 20, 100}; !reflect.DeepEqual(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+				return
+			}
+			got = append(got, v)
+		case <-timeout:
+			t.Fatalf("output not closed; received %v so far", got)
+		}
+	}
+}
+
+func TestMergeKeepsPerChannelOrder(t *testing.T) {
+	merged := Merge(send("a1", "a2", "a3"), send("b1", "b2", "b3"))
+
+	var a, b []string
+	for v := range merged {
+		if v[0] == 'a' {
+			a = append(a, v)
+		} else {
+			b = append(b, v)
+		}
+	}
+	if len(a) != 3 || a[0] != "a1" || a[2] != "a3" || len(b) != 3 || b[0] != "b1" || b[2] != "b3" {
+		t.Errorf("a = %v, b = %v; want each input's values in send order", a, b)
+	}
+}
+
+func TestMergeWaitsForSlowestInput(t *testing.T) {
+	slow := make(chan int)
+	merged := Merge(send(1), slow)
+
+	if v := <-merged; v != 1 {
+		t.Fatalf("first value = %d, want 1", v)
+	}
+	select {
+	case v, ok := <-merged:
+		t.Fatalf("received %d, %t while an input was still open", v, ok)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(slow)
+	if _, ok := <-merged; ok {
+		t.Error("output still open after every input closed")
+	}
+}
+
+func TestMergeWithNoInputsClosesImmediately(t *testing.T) {
+	select {
+	case _, ok := <-Merge[int]():
+		if ok {
+			t.Error("received a value from an empty merge")
+		}
+	case <-time.After(time.Second):
+		t.Error("empty merge never closed")
+	}
+}
+
+// === TIMEOUT WITH FALLBACK ===
+
+func TestWithTimeoutReturnsFastResult(t *testing.T) {
+	got, err := WithTimeout(context.Background(), time.Second, func(context.Context) (string, error) {
+		return "fresh", nil
+	}, "fallback")
+
+	if err != nil || got != "fresh" {
+		t.Errorf("WithTimeout = %q, %v; want fresh, nil", got, err)
+	}
+}
+
+func TestWithTimeoutPassesThroughFnError(t *testing.T) {
+	errLookup := errors.New("lookup failed")
+	got, err := WithTimeout(context.Background(), time.Second, func(context.Context) (int, error) {
+		return 0, errLookup
+	}, -1)
+
+	if !errors.Is(err, errLookup) || got != 0 {
+		t.Errorf("WithTimeout = %d, %v; want fn's own result and error", got, err)
+	}
+}
+
+func TestWithTimeoutFallsBackWhenSlow(t *testing.T) {
+	got, err := WithTimeout(context.Background(), 20*time.Millisecond, func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond) // finish after the caller gave up
+		return "late", ctx.Err()
+	}, "fallback")
+
+	if got != "fallback" || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WithTimeout = %q, %v; want fallback, DeadlineExceeded", got, err)
+	}
+}
+
+func TestWithTimeoutDoesNotWaitForFnIgnoringContext(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	start := time.Now()
+	got, err := WithTimeout(context.Background(), 20*time.Millisecond, func(context.Context) (int, error) {
+		<-release
+		return 1, nil
+	}, 42)
+
+	if got != 42 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WithTimeout = %d, %v; want 42, DeadlineExceeded", got, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %v, want close to the 20ms timeout", elapsed)
+	}
+}
+
+func TestWithTimeoutHonorsParentCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	got, err := WithTimeout(ctx, time.Second, func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		return "", ctx.Err()
+	}, "fallback")
+
+	if got != "fallback" || !errors.Is(err, context.Canceled) {
+		t.Errorf("WithTimeout = %q, %v; want fallback, context.Canceled", got, err)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		t.Error("cancellation reported as a timeout")
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"runtime"
@@ -244,6 +246,58 @@ func parallelFilter(data []int, predicate func(int) bool, numWorkers int) []int
 	return combined
 }
 
+// ParallelForEach runs fn on every item using up to workers goroutines.
+// The first error cancels the context passed to the remaining calls and
+// stops new items from starting; that error is returned. If ctx itself is
+// cancelled first, ctx.Err() is returned.
+func ParallelForEach[T any](ctx context.Context, items []T, workers int, fn func(context.Context, T) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		firstErr error
+		errOnce  sync.Once
+		wg       sync.WaitGroup
+	)
+
+	jobs := make(chan T)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				if err := fn(ctx, item); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case jobs <- item:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
 // === PIPELINE STAGES ===
 
 func generateNumbers(count int) <-chan int {
@@ -408,6 +462,28 @@ func main() {
 	fmt.Printf("Sequential filter: %v (took %v)\n", seqFiltered, seqFilterDuration)
 	fmt.Printf("Parallel filter: %v (took %v)\n", parFiltered, parFilterDuration)
 
+	// Parallel for-each that stops at the first failure
+	errBadItem := errors.New("item 13 is unlucky")
+	var processed sync.Map
+	err := ParallelForEach(context.Background(), smallData, 4, func(ctx context.Context, n int) error {
+		if n == 13 {
+			return errBadItem
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+		processed.Store(n, true)
+		return nil
+	})
+	processedCount := 0
+	processed.Range(func(_, _ any) bool {
+		processedCount++
+		return true
+	})
+	fmt.Printf("ParallelForEach error: %v (processed %d of %d)\n", err, processedCount, len(smallData))
+
 	// === PARALLEL PIPELINE ===
 	fmt.Println("\n6. PARALLEL PIPELINE:")
 
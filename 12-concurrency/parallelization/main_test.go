@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// === PARALLEL FOR EACH ===
+
+func numbers(n int) []int {
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+func TestParallelForEachProcessesEveryItem(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+
+	err := ParallelForEach(context.Background(), numbers(50), 4, func(_ context.Context, n int) error {
+		mu.Lock()
+		seen[n] = true
+		mu.Unlock()
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("ParallelForEach = %v, want nil", err)
+	}
+	if len(seen) != 50 {
+		t.Errorf("processed %d distinct items, want 50", len(seen))
+	}
+}
+
+func TestParallelForEachClampsWorkers(t *testing.T) {
+	var count atomic.Int32
+	err := ParallelForEach(context.Background(), numbers(5), 0, func(context.Context, int) error {
+		count.Add(1)
+		return nil
+	})
+	if err != nil || count.Load() != 5 {
+		t.Errorf("ParallelForEach with 0 workers = %v after %d items, want nil after 5", err, count.Load())
+	}
+}
+
+func TestParallelForEachFirstErrorCancelsRest(t *testing.T) {
+	errBoom := errors.New("boom")
+	var started, sawCancel atomic.Int32
+
+	err := ParallelForEach(context.Background(), numbers(100), 3, func(ctx context.Context, n int) error {
+		started.Add(1)
+		if n == 0 {
+			return errBoom
+		}
+		// Everyone else blocks until the failure cancels them
+		<-ctx.Done()
+		sawCancel.Add(1)
+		return ctx.Err()
+	})
+
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("ParallelForEach = %v, want the first error", err)
+	}
+	if n := started.Load(); n >= 100 {
+		t.Errorf("started %d items, want the rest skipped after the error", n)
+	}
+	if sawCancel.Load() != started.Load()-1 {
+		t.Errorf("%d of %d other calls saw cancellation", sawCancel.Load(), started.Load()-1)
+	}
+}
+
+func TestParallelForEachStopsWhenContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var processed atomic.Int32
+
+	err := ParallelForEach(ctx, numbers(100), 2, func(context.Context, int) error {
+		if processed.Add(1) == 5 {
+			cancel()
+		}
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ParallelForEach = %v, want context.Canceled", err)
+	}
+	if n := processed.Load(); n >= 100 {
+		t.Errorf("processed %d items, want fewer than all after cancel", n)
+	}
+}
+
+func TestParallelForEachEmpty(t *testing.T) {
+	err := ParallelForEach(context.Background(), []string(nil), 4, func(context.Context, string) error {
+		t.Error("fn called for an empty slice")
+		return nil
+	})
+	if err != nil {
+		t.Errorf("ParallelForEach on empty input = %v, want nil", err)
+	}
+}
@@ -44,6 +44,22 @@ type Company struct {
 	Employees []Person `json:"employees" xml:"employees>person"`
 }
 
+// contextKey is unexported so no other package can collide with our keys
+type contextKey int
+
+const userIDKey contextKey = iota
+
+// WithUserID returns a copy of ctx carrying the user ID
+func WithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
+// UserIDFromContext returns the user ID stored by WithUserID, if any
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(userIDKey).(string)
+	return id, ok
+}
+
 func main() {
 	fmt.Println("=== GO STANDARD LIBRARY COMPREHENSIVE GUIDE ===")
 
@@ -635,11 +651,14 @@ func main() {
 		fmt.Println("Operation timed out")
 	}
 
-	// Context with value
-	ctx = context.WithValue(context.Background(), "userID", "12345")
-	if userID := ctx.Value("userID"); userID != nil {
+	// Context with value - use a typed key, never a bare string
+	ctx = WithUserID(context.Background(), "12345")
+	if userID, ok := UserIDFromContext(ctx); ok {
 		fmt.Printf("User ID from context: %s\n", userID)
 	}
+	if _, ok := UserIDFromContext(context.Background()); !ok {
+		fmt.Println("No user ID in empty context")
+	}
 
 	// === LOG PACKAGE ===
 	fmt.Println("\n--- LOG PACKAGE ---")
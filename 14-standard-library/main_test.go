@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// === CONTEXT KEYS ===
+
+func TestUserIDRoundTrip(t *testing.T) {
+	ctx := WithUserID(context.Background(), "user-42")
+
+	id, ok := UserIDFromContext(ctx)
+	if !ok || id != "user-42" {
+		t.Errorf("UserIDFromContext = %q, %t; want user-42, true", id, ok)
+	}
+}
+
+func TestUserIDMissing(t *testing.T) {
+	if id, ok := UserIDFromContext(context.Background()); ok || id != "" {
+		t.Errorf("UserIDFromContext on empty context = %q, %t; want \"\", false", id, ok)
+	}
+}
+
+// otherKey mimics another package's key type with the same underlying value
+type otherKey int
+
+func TestUserIDKeyDoesNotCollide(t *testing.T) {
+	// Same underlying value, or the bare string the old demo used,
+	// must not be mistaken for our key
+	ctx := context.WithValue(context.Background(), otherKey(userIDKey), "intruder")
+	ctx = context.WithValue(ctx, "userID", "intruder")
+
+	if id, ok := UserIDFromContext(ctx); ok {
+		t.Errorf("UserIDFromContext = %q, want no value for foreign keys", id)
+	}
+
+	ctx = WithUserID(ctx, "user-1")
+	if id, _ := UserIDFromContext(ctx); id != "user-1" {
+		t.Errorf("UserIDFromContext = %q, want user-1", id)
+	}
+	if v := ctx.Value(otherKey(userIDKey)); v != "intruder" {
+		t.Errorf("foreign key value = %v, want it left untouched", v)
+	}
+}
+
+func TestUserIDWrongTypeReportsMissing(t *testing.T) {
+	ctx := context.WithValue(context.Background(), userIDKey, 42)
+
+	if id, ok := UserIDFromContext(ctx); ok {
+		t.Errorf("UserIDFromContext = %q, want false for a non-string value", id)
+	}
+}
@@ -1,17 +1,42 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // === PROJECT 15: COMPREHENSIVE GO WEB API ===
@@ -45,21 +70,99 @@ LEARNING OBJECTIVES:
 
 // User represents a user in the system
 type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"` // Never serialize password
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int        `json:"id"`
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	Password  string     `json:"-"` // Never serialize password
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // nil unless soft-deleted
 }
 
 // UserResponse represents the user data sent to clients
 type UserResponse struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int        `json:"id"`
+	Username  string     `json:"username"`
+	Email     string     `json:"email"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // nil unless soft-deleted
+}
+
+// Page is one window of a larger list plus the metadata needed to fetch more
+type Page[T any] struct {
+	Items   []T  `json:"items"`
+	Total   int  `json:"total"`
+	Offset  int  `json:"offset"`
+	Limit   int  `json:"limit"`
+	HasMore bool `json:"has_more"`
+}
+
+// defaultPageLimit is used when a list request doesn't specify ?limit
+const defaultPageLimit = 20
+
+// maxPageLimit caps ?limit; larger values are clamped to it.
+// main sets it from Config.MaxPageLimit.
+var maxPageLimit = 100
+
+// parsePagination reads ?offset= and ?limit=, or ?page= and ?per_page=
+// when either is present. Missing values use defaults and a limit above
+// maxPageLimit is clamped. A bad offset/limit returns an error wrapping
+// ErrInvalidPagination; a bad page/per_page falls back to its default.
+func parsePagination(r *http.Request) (offset, limit int, err error) {
+	query := r.URL.Query()
+
+	if query.Has("page") || query.Has("per_page") {
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		perPage, err := strconv.Atoi(query.Get("per_page"))
+		if err != nil || perPage < 1 {
+			perPage = defaultPageLimit
+		}
+		perPage = min(perPage, maxPageLimit)
+		return (page - 1) * perPage, perPage, nil
+	}
+
+	if raw := query.Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("%w: offset must be a non-negative integer, got %q", ErrInvalidPagination, raw)
+		}
+	}
+
+	limit = defaultPageLimit
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("%w: limit must be a positive integer, got %q", ErrInvalidPagination, raw)
+		}
+	}
+
+	return offset, min(limit, maxPageLimit), nil
+}
+
+// Paginate returns items[offset:offset+limit] as a Page. Out-of-range
+// offsets yield an empty page rather than an error.
+func Paginate[T any](items []T, offset, limit int) Page[T] {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+
+	start := min(offset, len(items))
+	end := min(start+limit, len(items))
+
+	return Page[T]{
+		Items:   append([]T{}, items[start:end]...),
+		Total:   len(items),
+		Offset:  offset,
+		Limit:   limit,
+		HasMore: end < len(items),
+	}
 }
 
 // CreateUserRequest represents the request to create a user
@@ -69,12 +172,19 @@ type CreateUserRequest struct {
 	Password string `json:"password"`
 }
 
-// UpdateUserRequest represents the request to update a user
+// UpdateUserRequest represents the request to replace a user (PUT)
 type UpdateUserRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email"`
 }
 
+// PatchUserRequest represents a partial update (PATCH). A nil field was
+// omitted and stays unchanged; a non-nil one is set, even to "".
+type PatchUserRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+}
+
 // LoginRequest represents the login request
 type LoginRequest struct {
 	Username string `json:"username"`
@@ -87,23 +197,163 @@ type LoginResponse struct {
 	Token string       `json:"token"`
 }
 
-// APIError represents an API error response
+// APIError represents an API error response. Errors is only set for
+// validation failures.
 type APIError struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-	Code    int    `json:"code"`
+	Error   string           `json:"error"`
+	Message string           `json:"message"`
+	Code    int              `json:"code"`
+	Errors  ValidationErrors `json:"errors,omitempty"`
+}
+
+// ValidationErrors maps request field names to what is wrong with them.
+// Every user endpoint sends it with HTTP 422 as the errors of an APIError
+// whose message joins them.
+type ValidationErrors map[string]string
+
+// Messages returns "field message" for every entry, sorted by field
+func (v ValidationErrors) Messages() []string {
+	messages := make([]string, 0, len(v))
+	for field, msg := range v {
+		messages = append(messages, field+" "+msg)
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+func (v ValidationErrors) Error() string {
+	return "validation failed: " + strings.Join(v.Messages(), ", ")
+}
+
+// emailPattern is the same address check the standard library demo uses
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// createUserFields is the order ValidateCreateUser checks fields in
+var createUserFields = []string{"username", "email", "password"}
+
+// ValidateCreateUser returns every problem with a create request, e.g.
+// "email must be a valid email address"; it is empty if the request is
+// valid
+func ValidateCreateUser(req CreateUserRequest) []string {
+	errs := validateCreateUser(req)
+	var problems []string
+	for _, field := range createUserFields {
+		if msg, ok := errs[field]; ok {
+			problems = append(problems, field+" "+msg)
+		}
+	}
+	return problems
+}
+
+// validateCreateUser is ValidateCreateUser keyed by field
+func validateCreateUser(req CreateUserRequest) ValidationErrors {
+	errs := ValidationErrors{}
+	if n := utf8.RuneCountInString(req.Username); n < 3 || n > 20 {
+		errs["username"] = "must be between 3 and 20 characters"
+	}
+	if !emailPattern.MatchString(req.Email) {
+		errs["email"] = "must be a valid email address"
+	}
+	if len(req.Password) < 8 {
+		errs["password"] = "must be at least 8 characters"
+	}
+	return errs
+}
+
+// Validate checks that a replacement carries every field
+func (req UpdateUserRequest) Validate() ValidationErrors {
+	errs := ValidationErrors{}
+	if req.Username == "" {
+		errs["username"] = "is required"
+	}
+	if req.Email == "" {
+		errs["email"] = "is required"
+	}
+	return errs
+}
+
+// Validate rejects fields that are present but would clear a required value
+func (req PatchUserRequest) Validate() ValidationErrors {
+	errs := ValidationErrors{}
+	if req.Username != nil && *req.Username == "" {
+		errs["username"] = "cannot be empty"
+	}
+	if req.Email != nil && *req.Email == "" {
+		errs["email"] = "cannot be empty"
+	}
+	return errs
+}
+
+// === ERRORS ===
+
+var (
+	// ErrUserNotFound is returned when no user matches the lookup
+	ErrUserNotFound = errors.New("user not found")
+	// ErrCircuitOpen is returned when the circuit breaker is failing fast
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+	// ErrInvalidPagination is returned for bad offset/limit query parameters
+	ErrInvalidPagination = errors.New("invalid pagination")
+	// ErrUnknownField is returned by strictDecode for JSON keys the target doesn't declare
+	ErrUnknownField = errors.New("unknown field")
+	// ErrDuplicateUser is returned when a username or email is already taken
+	ErrDuplicateUser = errors.New("duplicate user")
+	// ErrTokenMalformed is returned for tokens that aren't a JWT we issued
+	ErrTokenMalformed = errors.New("malformed token")
+	// ErrTokenSignature is returned when a token's signature doesn't match
+	ErrTokenSignature = errors.New("invalid token signature")
+	// ErrTokenExpired is returned for correctly signed tokens past their expiry
+	ErrTokenExpired = errors.New("token expired")
+	// ErrInvalidCredentials is returned by UserService.Login for an unknown
+	// username or a wrong password, without saying which
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// strictDecode decodes a JSON body into a T, rejecting fields T doesn't
+// declare so client typos fail loudly instead of being ignored
+func strictDecode[T any](r io.Reader) (T, error) {
+	var v T
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		// encoding/json has no typed error for this case, only the message
+		if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return v, fmt.Errorf("%w %s", ErrUnknownField, name)
+		}
+		return v, err
+	}
+	return v, nil
+}
+
+// Must returns v or panics if err is non-nil.
+// Use it only during startup, where a failure means the app can't run at all.
+func Must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Try logs a non-nil runtime error instead of silently dropping it
+func Try(err error, logger Logger) {
+	if err != nil {
+		logger.Error("Unhandled error", "error", err)
+	}
 }
 
 // === INTERFACES ===
 
 // UserRepository defines the interface for user data operations
 type UserRepository interface {
-	GetAll() ([]User, error)
-	GetByID(id int) (*User, error)
-	GetByUsername(username string) (*User, error)
-	Create(user *User) error
-	Update(user *User) error
-	Delete(id int) error
+	GetAllContext(ctx context.Context) ([]User, error)
+	GetPaginatedContext(ctx context.Context, limit, offset int, includeDeleted bool) ([]User, int, error)
+	Iterate(ctx context.Context, fn func(user User) error) error
+	GetByIDContext(ctx context.Context, id int) (*User, error)
+	GetByUsernameContext(ctx context.Context, username string) (*User, error)
+	CreateContext(ctx context.Context, user *User) error
+	BatchCreateContext(ctx context.Context, users []*User) error
+	UpdateContext(ctx context.Context, user *User) error
+	DeleteContext(ctx context.Context, id int) error
+	RestoreContext(ctx context.Context, id int) error
 }
 
 // Logger interface for logging operations
@@ -113,6 +363,19 @@ type Logger interface {
 	Debug(msg string, fields ...interface{})
 }
 
+// TokenStore tracks revoked tokens so logout can invalidate them
+type TokenStore interface {
+	Revoke(id string)
+	IsRevoked(id string) bool
+}
+
+// PasswordHasher turns plaintext passwords into stored hashes and checks
+// login attempts against them
+type PasswordHasher interface {
+	Hash(plain string) (string, error)
+	Compare(hash, plain string) error
+}
+
 // === IMPLEMENTATIONS ===
 
 // SQLiteUserRepository implements UserRepository for SQLite
@@ -125,23 +388,78 @@ func NewSQLiteUserRepository(db *sql.DB) *SQLiteUserRepository {
 	return &SQLiteUserRepository{db: db}
 }
 
-// GetAll retrieves all users from the database
-func (r *SQLiteUserRepository) GetAll() ([]User, error) {
+// queryTimeout bounds every single-statement query, so a stuck database
+// can't hold a request open even if the client never disconnects
+const queryTimeout = 5 * time.Second
+
+func withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, queryTimeout)
+}
+
+// GetAllContext retrieves all users that haven't been deleted
+func (r *SQLiteUserRepository) GetAllContext(ctx context.Context) ([]User, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
-		SELECT id, username, email, password, created_at, updated_at 
+		SELECT id, username, email, password, created_at, updated_at, deleted_at 
 		FROM users 
+		WHERE deleted_at IS NULL
 		ORDER BY created_at DESC
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
 	defer rows.Close()
 
+	return scanUsers(rows)
+}
+
+// GetPaginatedContext retrieves one page of users plus the total number of users.
+// Soft-deleted users are skipped unless includeDeleted is set.
+func (r *SQLiteUserRepository) GetPaginatedContext(ctx context.Context, limit, offset int, includeDeleted bool) ([]User, int, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	where := "WHERE deleted_at IS NULL"
+	if includeDeleted {
+		where = ""
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users "+where).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	query := `
+		SELECT id, username, email, password, created_at, updated_at, deleted_at 
+		FROM users 
+		` + where + `
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	users, err := scanUsers(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// scanUsers reads every remaining row of a users query
+func scanUsers(rows *sql.Rows) ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var user User
+		var deletedAt sql.NullTime
 		err := rows.Scan(
 			&user.ID,
 			&user.Username,
@@ -149,30 +467,78 @@ func (r *SQLiteUserRepository) GetAll() ([]User, error) {
 			&user.Password,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&deletedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
+		if deletedAt.Valid {
+			user.DeletedAt = &deletedAt.Time
+		}
 		users = append(users, user)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating users: %w", err)
 	}
 
 	return users, nil
 }
 
-// GetByID retrieves a user by ID
-func (r *SQLiteUserRepository) GetByID(id int) (*User, error) {
+// Iterate calls fn for each user row without loading the whole table into memory
+func (r *SQLiteUserRepository) Iterate(ctx context.Context, fn func(user User) error) error {
+	query := `
+		SELECT id, username, email, password, created_at, updated_at 
+		FROM users 
+		WHERE deleted_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.Password,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan user: %w", err)
+		}
+
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating users: %w", err)
+	}
+
+	return nil
+}
+
+// GetByIDContext retrieves a user by ID
+func (r *SQLiteUserRepository) GetByIDContext(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, username, email, password, created_at, updated_at 
 		FROM users 
-		WHERE id = ?
+		WHERE id = ? AND deleted_at IS NULL
 	`
 
 	var user User
-	err := r.db.QueryRow(query, id).Scan(
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -183,7 +549,7 @@ func (r *SQLiteUserRepository) GetByID(id int) (*User, error) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -191,16 +557,19 @@ func (r *SQLiteUserRepository) GetByID(id int) (*User, error) {
 	return &user, nil
 }
 
-// GetByUsername retrieves a user by username
-func (r *SQLiteUserRepository) GetByUsername(username string) (*User, error) {
+// GetByUsernameContext retrieves a user by username
+func (r *SQLiteUserRepository) GetByUsernameContext(ctx context.Context, username string) (*User, error) {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
 		SELECT id, username, email, password, created_at, updated_at 
 		FROM users 
-		WHERE username = ?
+		WHERE username = ? AND deleted_at IS NULL
 	`
 
 	var user User
-	err := r.db.QueryRow(query, username).Scan(
+	err := r.db.QueryRowContext(ctx, query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
@@ -211,7 +580,7 @@ func (r *SQLiteUserRepository) GetByUsername(username string) (*User, error) {
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -219,8 +588,11 @@ func (r *SQLiteUserRepository) GetByUsername(username string) (*User, error) {
 	return &user, nil
 }
 
-// Create creates a new user
-func (r *SQLiteUserRepository) Create(user *User) error {
+// CreateContext creates a new user
+func (r *SQLiteUserRepository) CreateContext(ctx context.Context, user *User) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
 		INSERT INTO users (username, email, password, created_at, updated_at)
 		VALUES (?, ?, ?, ?, ?)
@@ -230,8 +602,11 @@ func (r *SQLiteUserRepository) Create(user *User) error {
 	user.CreatedAt = now
 	user.UpdatedAt = now
 
-	result, err := r.db.Exec(query, user.Username, user.Email, user.Password, now, now)
+	result, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.Password, now, now)
 	if err != nil {
+		if dupErr := duplicateUserError(err); dupErr != nil {
+			return dupErr
+		}
 		return fmt.Errorf("failed to create user: %w", err)
 	}
 
@@ -244,18 +619,89 @@ func (r *SQLiteUserRepository) Create(user *User) error {
 	return nil
 }
 
-// Update updates an existing user
-func (r *SQLiteUserRepository) Update(user *User) error {
+// duplicateUserError converts a SQLite unique-constraint violation into an
+// error wrapping ErrDuplicateUser that names the column, e.g.
+// "duplicate user: email already exists". Other errors return nil.
+func duplicateUserError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return nil
+	}
+
+	// SQLite reports the column as "UNIQUE constraint failed: users.email"
+	field := "field"
+	if _, column, ok := strings.Cut(sqliteErr.Error(), "users."); ok {
+		field = column
+	}
+	return fmt.Errorf("%w: %s already exists", ErrDuplicateUser, field)
+}
+
+// BatchCreateContext inserts all users in a single transaction; if any insert
+// fails, none of them are persisted
+func (r *SQLiteUserRepository) BatchCreateContext(ctx context.Context, users []*User) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // no-op after a successful commit
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO users (username, email, password, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, user := range users {
+		result, err := stmt.ExecContext(ctx, user.Username, user.Email, user.Password, now, now)
+		if err != nil {
+			if dupErr := duplicateUserError(err); dupErr != nil {
+				err = dupErr
+			}
+			return fmt.Errorf("failed to create user %q: %w", user.Username, err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get last insert ID: %w", err)
+		}
+
+		user.ID = int(id)
+		user.CreatedAt = now
+		user.UpdatedAt = now
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit users: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateContext updates an existing user
+func (r *SQLiteUserRepository) UpdateContext(ctx context.Context, user *User) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
 	query := `
 		UPDATE users 
 		SET username = ?, email = ?, updated_at = ?
-		WHERE id = ?
+		WHERE id = ? AND deleted_at IS NULL
 	`
 
 	user.UpdatedAt = time.Now()
 
-	result, err := r.db.Exec(query, user.Username, user.Email, user.UpdatedAt, user.ID)
+	result, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.UpdatedAt, user.ID)
 	if err != nil {
+		if dupErr := duplicateUserError(err); dupErr != nil {
+			return dupErr
+		}
 		return fmt.Errorf("failed to update user: %w", err)
 	}
 
@@ -265,17 +711,20 @@ func (r *SQLiteUserRepository) Update(user *User) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+		return ErrUserNotFound
 	}
 
 	return nil
 }
 
-// Delete deletes a user by ID
-func (r *SQLiteUserRepository) Delete(id int) error {
-	query := `DELETE FROM users WHERE id = ?`
+// DeleteContext soft-deletes a user by ID, keeping the row for auditing
+func (r *SQLiteUserRepository) DeleteContext(ctx context.Context, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`
 
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -286,7 +735,35 @@ func (r *SQLiteUserRepository) Delete(id int) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// RestoreContext undoes a soft delete. It returns ErrUserNotFound if id
+// doesn't exist or isn't deleted.
+func (r *SQLiteUserRepository) RestoreContext(ctx context.Context, id int) error {
+	ctx, cancel := withQueryTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE users SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		if dupErr := duplicateUserError(err); dupErr != nil {
+			return dupErr
+		}
+		return fmt.Errorf("failed to restore user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
 	}
 
 	return nil
@@ -307,268 +784,2222 @@ func (l *SimpleLogger) Debug(msg string, fields ...interface{}) {
 	log.Printf("[DEBUG] %s %v", msg, fields)
 }
 
-// === HANDLERS ===
+// LogLevel is the minimum severity a logger emits
+type LogLevel int
 
-// UserHandler handles user-related HTTP requests
-type UserHandler struct {
-	userRepo UserRepository
-	logger   Logger
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
 }
 
-// NewUserHandler creates a new user handler
-func NewUserHandler(userRepo UserRepository, logger Logger) *UserHandler {
-	return &UserHandler{
-		userRepo: userRepo,
-		logger:   logger,
+// ParseLogLevel converts a LOG_LEVEL value such as "info" into a LogLevel
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", name)
 	}
 }
 
-// GetUsers handles GET /api/users
-func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	h.logger.Info("Getting all users")
+// JSONLogger implements Logger by writing one JSON object per line with
+// level, msg, time and the key/value pairs from fields. Calls below the
+// configured level are dropped.
+type JSONLogger struct {
+	out   io.Writer
+	level LogLevel
+	now   func() time.Time
+	mu    sync.Mutex
+}
 
-	users, err := h.userRepo.GetAll()
-	if err != nil {
-		h.logger.Error("Failed to get users", "error", err)
-		h.writeError(w, http.StatusInternalServerError, "Failed to get users", err.Error())
-		return
-	}
+// NewJSONLogger creates a logger writing entries at level or above to out
+func NewJSONLogger(out io.Writer, level LogLevel) *JSONLogger {
+	return &JSONLogger{out: out, level: level, now: time.Now}
+}
 
-	// Convert to response format
-	var userResponses []UserResponse
-	for _, user := range users {
-		userResponses = append(userResponses, UserResponse{
-			ID:        user.ID,
-			Username:  user.Username,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-		})
-	}
+func (l *JSONLogger) Info(msg string, fields ...interface{}) {
+	l.log(LevelInfo, msg, fields)
+}
 
-	h.writeJSON(w, http.StatusOK, userResponses)
+func (l *JSONLogger) Error(msg string, fields ...interface{}) {
+	l.log(LevelError, msg, fields)
 }
 
-// GetUser handles GET /api/users/{id}
-func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
+func (l *JSONLogger) Debug(msg string, fields ...interface{}) {
+	l.log(LevelDebug, msg, fields)
+}
 
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
+func (l *JSONLogger) log(level LogLevel, msg string, fields []interface{}) {
+	if level < l.level {
 		return
 	}
 
-	h.logger.Info("Getting user", "id", id)
+	entry := map[string]interface{}{
+		"level": level.String(),
+		"msg":   msg,
+		"time":  l.now().Format(time.RFC3339Nano),
+	}
+	for i := 0; i < len(fields); i += 2 {
+		key := fmt.Sprint(fields[i])
+		if _, reserved := entry[key]; reserved {
+			key = "field." + key
+		}
 
-	user, err := h.userRepo.GetByID(id)
-	if err != nil {
-		h.logger.Error("Failed to get user", "id", id, "error", err)
-		h.writeError(w, http.StatusNotFound, "User not found", err.Error())
-		return
+		// A trailing key without a value is kept rather than dropped
+		var value interface{} = "(MISSING)"
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		switch v := value.(type) {
+		case error:
+			value = v.Error()
+		case time.Duration:
+			value = v.String()
+		}
+		entry[key] = value
 	}
 
-	userResponse := UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+	line, err := json.Marshal(entry)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{
+			"level": LevelError.String(),
+			"msg":   "failed to encode log entry",
+			"error": err.Error(),
+		})
 	}
 
-	h.writeJSON(w, http.StatusOK, userResponse)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(line, '\n'))
 }
 
-// CreateUser handles POST /api/users
-func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var req CreateUserRequest
+// === RESILIENCE ===
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body", err.Error())
-		return
-	}
+// CircuitBreakerState represents the state of a circuit breaker
+type CircuitBreakerState int
 
-	// Validate request
-	if req.Username == "" || req.Email == "" || req.Password == "" {
-		h.writeError(w, http.StatusBadRequest, "Missing required fields", "username, email, and password are required")
-		return
-	}
+const (
+	Closed CircuitBreakerState = iota
+	Open
+	HalfOpen
+)
 
-	h.logger.Info("Creating user", "username", req.Username)
+// CircuitBreaker stops calling a failing dependency until it has had time to recover
+type CircuitBreaker struct {
+	name            string
+	maxFailures     int
+	timeout         time.Duration
+	failures        int
+	lastFailureTime time.Time
+	state           CircuitBreakerState
+	mutex           sync.Mutex
+}
 
-	// Create user
-	user := &User{
-		Username: req.Username,
-		Email:    req.Email,
-		Password: req.Password, // In production, hash the password
+// NewCircuitBreaker creates a new circuit breaker
+func NewCircuitBreaker(name string, maxFailures int, timeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:        name,
+		maxFailures: maxFailures,
+		timeout:     timeout,
+		state:       Closed,
 	}
+}
 
-	if err := h.userRepo.Create(user); err != nil {
-		h.logger.Error("Failed to create user", "error", err)
-		h.writeError(w, http.StatusInternalServerError, "Failed to create user", err.Error())
-		return
+// Execute runs fn unless the breaker is open, recording the outcome.
+// The lock is not held while fn runs so concurrent queries aren't serialized.
+func (cb *CircuitBreaker) Execute(fn func() error) error {
+	cb.mutex.Lock()
+	if cb.state == Open {
+		if time.Since(cb.lastFailureTime) <= cb.timeout {
+			cb.mutex.Unlock()
+			return fmt.Errorf("%s: %w", cb.name, ErrCircuitOpen)
+		}
+		cb.state = HalfOpen
 	}
+	cb.mutex.Unlock()
 
-	userResponse := UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-	}
+	err := fn()
 
-	h.writeJSON(w, http.StatusCreated, userResponse)
-}
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
 
-// UpdateUser handles PUT /api/users/{id}
+	if err != nil {
+		cb.failures++
+		cb.lastFailureTime = time.Now()
+
+		if cb.state == HalfOpen || cb.failures >= cb.maxFailures {
+			cb.state = Open
+		}
+		return err
+	}
+
+	cb.failures = 0
+	cb.state = Closed
+	return nil
+}
+
+// GetState returns the current state of the circuit breaker
+func (cb *CircuitBreaker) GetState() CircuitBreakerState {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.state
+}
+
+// ResilientRepository decorates a UserRepository with a circuit breaker so a
+// dead database fails fast instead of being hammered with queries
+type ResilientRepository struct {
+	repo    UserRepository
+	breaker *CircuitBreaker
+}
+
+// NewResilientRepository wraps repo with breaker
+func NewResilientRepository(repo UserRepository, breaker *CircuitBreaker) *ResilientRepository {
+	return &ResilientRepository{repo: repo, breaker: breaker}
+}
+
+// call runs fn through the breaker. Lookups that simply find nothing,
+// writes rejected as duplicates and queries abandoned by a disconnected
+// client are returned to the caller but not counted as database failures.
+func (r *ResilientRepository) call(fn func() error) error {
+	var result error
+	err := r.breaker.Execute(func() error {
+		result = fn()
+		if errors.Is(result, ErrUserNotFound) || errors.Is(result, ErrDuplicateUser) ||
+			errors.Is(result, context.Canceled) {
+			return nil
+		}
+		return result
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+func (r *ResilientRepository) GetAllContext(ctx context.Context) ([]User, error) {
+	var users []User
+	err := r.call(func() (err error) {
+		users, err = r.repo.GetAllContext(ctx)
+		return err
+	})
+	return users, err
+}
+
+func (r *ResilientRepository) GetPaginatedContext(ctx context.Context, limit, offset int, includeDeleted bool) ([]User, int, error) {
+	var users []User
+	var total int
+	err := r.call(func() (err error) {
+		users, total, err = r.repo.GetPaginatedContext(ctx, limit, offset, includeDeleted)
+		return err
+	})
+	return users, total, err
+}
+
+// Iterate only counts query and scan errors against the breaker. An error
+// from fn, such as a write to a client that has gone away, says nothing
+// about the database.
+func (r *ResilientRepository) Iterate(ctx context.Context, fn func(user User) error) error {
+	var fnFailed bool
+	var callbackErr error
+	err := r.call(func() error {
+		err := r.repo.Iterate(ctx, func(user User) error {
+			err := fn(user)
+			fnFailed = err != nil
+			return err
+		})
+		if fnFailed {
+			callbackErr = err
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return callbackErr
+}
+
+func (r *ResilientRepository) GetByIDContext(ctx context.Context, id int) (*User, error) {
+	var user *User
+	err := r.call(func() (err error) {
+		user, err = r.repo.GetByIDContext(ctx, id)
+		return err
+	})
+	return user, err
+}
+
+func (r *ResilientRepository) GetByUsernameContext(ctx context.Context, username string) (*User, error) {
+	var user *User
+	err := r.call(func() (err error) {
+		user, err = r.repo.GetByUsernameContext(ctx, username)
+		return err
+	})
+	return user, err
+}
+
+func (r *ResilientRepository) CreateContext(ctx context.Context, user *User) error {
+	return r.call(func() error {
+		return r.repo.CreateContext(ctx, user)
+	})
+}
+
+func (r *ResilientRepository) BatchCreateContext(ctx context.Context, users []*User) error {
+	return r.call(func() error {
+		return r.repo.BatchCreateContext(ctx, users)
+	})
+}
+
+func (r *ResilientRepository) UpdateContext(ctx context.Context, user *User) error {
+	return r.call(func() error {
+		return r.repo.UpdateContext(ctx, user)
+	})
+}
+
+func (r *ResilientRepository) DeleteContext(ctx context.Context, id int) error {
+	return r.call(func() error {
+		return r.repo.DeleteContext(ctx, id)
+	})
+}
+
+func (r *ResilientRepository) RestoreContext(ctx context.Context, id int) error {
+	return r.call(func() error {
+		return r.repo.RestoreContext(ctx, id)
+	})
+}
+
+// CachedRepository decorates a UserRepository with a read-through cache of
+// users by ID. Writes made through it invalidate the affected user, so it
+// must be the only writer to the underlying store.
+type CachedRepository struct {
+	UserRepository
+	byID *Loader[int, User]
+}
+
+// NewCachedRepository wraps repo with a cache for GetByIDContext
+func NewCachedRepository(repo UserRepository) *CachedRepository {
+	return &CachedRepository{
+		UserRepository: repo,
+		byID: NewLoader(func(ctx context.Context, id int) (User, error) {
+			user, err := repo.GetByIDContext(ctx, id)
+			if err != nil {
+				return User{}, err
+			}
+			return *user, nil
+		}),
+	}
+}
+
+// GetByIDContext returns a copy of the cached user, loading it on a miss
+func (r *CachedRepository) GetByIDContext(ctx context.Context, id int) (*User, error) {
+	user, err := r.byID.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *CachedRepository) UpdateContext(ctx context.Context, user *User) error {
+	defer r.byID.Invalidate(user.ID)
+	return r.UserRepository.UpdateContext(ctx, user)
+}
+
+func (r *CachedRepository) DeleteContext(ctx context.Context, id int) error {
+	defer r.byID.Invalidate(id)
+	return r.UserRepository.DeleteContext(ctx, id)
+}
+
+func (r *CachedRepository) RestoreContext(ctx context.Context, id int) error {
+	defer r.byID.Invalidate(id)
+	return r.UserRepository.RestoreContext(ctx, id)
+}
+
+// InMemoryTokenStore implements TokenStore with a mutex-guarded map.
+// Revocations are kept only as long as the token could still be valid.
+type InMemoryTokenStore struct {
+	revoked map[string]time.Time
+	ttl     time.Duration
+	mu      sync.Mutex
+}
+
+// NewInMemoryTokenStore creates a token store that forgets revocations after ttl
+func NewInMemoryTokenStore(ttl time.Duration) *InMemoryTokenStore {
+	return &InMemoryTokenStore{
+		revoked: make(map[string]time.Time),
+		ttl:     ttl,
+	}
+}
+
+// Revoke marks a token as revoked until the TTL expires
+func (s *InMemoryTokenStore) Revoke(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[id] = time.Now().Add(s.ttl)
+}
+
+// IsRevoked reports whether a token has been revoked, dropping expired entries
+func (s *InMemoryTokenStore) IsRevoked(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, exists := s.revoked[id]
+	if !exists {
+		return false
+	}
+
+	if time.Now().After(expiresAt) {
+		delete(s.revoked, id)
+		return false
+	}
+
+	return true
+}
+
+// BcryptHasher implements PasswordHasher with bcrypt
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher creates a hasher with the given cost, or bcrypt's default
+// cost when cost is 0
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+// Hash returns the bcrypt hash of plain
+func (h *BcryptHasher) Hash(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), h.cost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Compare returns nil if plain matches hash. A hash that isn't bcrypt at
+// all, such as a legacy plaintext row, is reported as an error too.
+func (h *BcryptHasher) Compare(hash, plain string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain))
+}
+
+// jwtHeader is the encoded header of every token TokenService issues.
+// Verify requires it verbatim, so tokens claiming another alg are rejected.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// tokenClaims is the JWT payload; the subject is the user ID
+type tokenClaims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// TokenService issues and verifies HS256-signed JWTs carrying a user ID
+type TokenService struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewTokenService creates a token service signing with secret; issued
+// tokens expire after ttl
+func NewTokenService(secret []byte, ttl time.Duration) *TokenService {
+	return &TokenService{secret: secret, ttl: ttl, now: time.Now}
+}
+
+// Issue returns a signed token for userID
+func (ts *TokenService) Issue(userID int) (string, error) {
+	now := ts.now()
+	payload, err := json.Marshal(tokenClaims{
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ts.ttl).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token claims: %w", err)
+	}
+
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(ts.sign(signingInput)), nil
+}
+
+// Verify checks the token's signature and expiry and returns its user ID
+func (ts *TokenService) Verify(token string) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return 0, ErrTokenMalformed
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, ErrTokenMalformed
+	}
+	if !hmac.Equal(signature, ts.sign(parts[0]+"."+parts[1])) {
+		return 0, ErrTokenSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, ErrTokenMalformed
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return 0, ErrTokenMalformed
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return 0, ErrTokenMalformed
+	}
+
+	if ts.now().Unix() >= claims.ExpiresAt {
+		return 0, ErrTokenExpired
+	}
+	return userID, nil
+}
+
+// sign returns the HMAC-SHA256 of input under the service's secret
+func (ts *TokenService) sign(input string) []byte {
+	mac := hmac.New(sha256.New, ts.secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// TeeLogger implements Logger by forwarding every call to several loggers,
+// e.g. stdout plus a buffer that tests can assert against
+type TeeLogger struct {
+	loggers []Logger
+}
+
+// NewTeeLogger creates a logger that fans out to all of the given loggers
+func NewTeeLogger(loggers ...Logger) *TeeLogger {
+	return &TeeLogger{loggers: loggers}
+}
+
+func (l *TeeLogger) Info(msg string, fields ...interface{}) {
+	for _, logger := range l.loggers {
+		logger.Info(msg, fields...)
+	}
+}
+
+func (l *TeeLogger) Error(msg string, fields ...interface{}) {
+	for _, logger := range l.loggers {
+		logger.Error(msg, fields...)
+	}
+}
+
+func (l *TeeLogger) Debug(msg string, fields ...interface{}) {
+	for _, logger := range l.loggers {
+		logger.Debug(msg, fields...)
+	}
+}
+
+// RateLimitedLogger wraps a Logger and drops repeats of the same message
+// template (level and text, whatever the fields) beyond limit per
+// interval, so a failing dependency can't flood the log. Flush reports
+// how many copies were suppressed; run it on a ticker.
+type RateLimitedLogger struct {
+	next     Logger
+	limit    int
+	interval time.Duration
+	windows  map[string]*logWindow
+	now      func() time.Time
+	mu       sync.Mutex
+}
+
+// logWindow tracks one message template within the current interval
+type logWindow struct {
+	msg        string
+	started    time.Time
+	count      int
+	suppressed int
+}
+
+// NewRateLimitedLogger creates a logger passing at most limit copies of
+// each message template per interval through to next
+func NewRateLimitedLogger(next Logger, limit int, interval time.Duration) *RateLimitedLogger {
+	return &RateLimitedLogger{
+		next:     next,
+		limit:    limit,
+		interval: interval,
+		windows:  make(map[string]*logWindow),
+		now:      time.Now,
+	}
+}
+
+func (l *RateLimitedLogger) Info(msg string, fields ...interface{}) {
+	if l.allow("INFO", msg) {
+		l.next.Info(msg, fields...)
+	}
+}
+
+func (l *RateLimitedLogger) Error(msg string, fields ...interface{}) {
+	if l.allow("ERROR", msg) {
+		l.next.Error(msg, fields...)
+	}
+}
+
+func (l *RateLimitedLogger) Debug(msg string, fields ...interface{}) {
+	if l.allow("DEBUG", msg) {
+		l.next.Debug(msg, fields...)
+	}
+}
+
+// allow reports whether this message template is still under its limit
+func (l *RateLimitedLogger) allow(level, msg string) bool {
+	key := level + "|" + msg
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	w, exists := l.windows[key]
+	if !exists {
+		w = &logWindow{msg: msg, started: now}
+		l.windows[key] = w
+	} else if now.Sub(w.started) >= l.interval {
+		// Start a new window but keep the suppressed count for Flush
+		w.started = now
+		w.count = 0
+	}
+
+	w.count++
+	if w.count > l.limit {
+		w.suppressed++
+		return false
+	}
+	return true
+}
+
+// Flush logs a summary for every template with suppressed copies and
+// forgets templates whose window has closed
+func (l *RateLimitedLogger) Flush() {
+	l.mu.Lock()
+	now := l.now()
+	var summaries []logWindow
+	for key, w := range l.windows {
+		if w.suppressed > 0 {
+			summaries = append(summaries, *w)
+			w.suppressed = 0
+		}
+		if now.Sub(w.started) >= l.interval {
+			delete(l.windows, key)
+		}
+	}
+	l.mu.Unlock()
+
+	// Log outside the lock so a slow writer doesn't serialize callers
+	for _, s := range summaries {
+		l.next.Info(fmt.Sprintf("Suppressed %d duplicate log messages", s.suppressed),
+			"message", s.msg, "interval", l.interval)
+	}
+}
+
+// runEvery calls fn every interval until ctx is done
+func runEvery(ctx context.Context, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// LoginLimiter locks a username out for a cooldown after too many
+// consecutive failed login attempts
+type LoginLimiter struct {
+	maxFailures int
+	cooldown    time.Duration
+	attempts    map[string]*loginAttempts
+	mu          sync.Mutex
+}
+
+// loginAttempts tracks consecutive failures for one username
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// NewLoginLimiter creates a limiter allowing maxFailures attempts per cooldown
+func NewLoginLimiter(maxFailures int, cooldown time.Duration) *LoginLimiter {
+	return &LoginLimiter{
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+		attempts:    make(map[string]*loginAttempts),
+	}
+}
+
+// LockedFor returns how long the username remains locked out (0 if not locked)
+func (l *LoginLimiter) LockedFor(username string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, exists := l.attempts[username]
+	if !exists {
+		return 0
+	}
+
+	now := time.Now()
+	if now.Before(a.lockedUntil) {
+		return a.lockedUntil.Sub(now)
+	}
+
+	// Forget stale failures once the cooldown window has passed
+	if now.Sub(a.lastFailure) > l.cooldown {
+		delete(l.attempts, username)
+	}
+	return 0
+}
+
+// RecordFailure counts a failed attempt, locking the username at the threshold
+func (l *LoginLimiter) RecordFailure(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, exists := l.attempts[username]
+	if !exists {
+		a = &loginAttempts{}
+		l.attempts[username] = a
+	}
+
+	now := time.Now()
+	a.failures++
+	a.lastFailure = now
+
+	if a.failures >= l.maxFailures {
+		a.lockedUntil = now.Add(l.cooldown)
+		a.failures = 0
+	}
+}
+
+// RecordSuccess clears any failures for the username
+func (l *LoginLimiter) RecordSuccess(username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, username)
+}
+
+// Sweep forgets usernames whose lockout and last failure are both older
+// than the cooldown, so names that are never tried again don't pile up
+func (l *LoginLimiter) Sweep() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for username, a := range l.attempts {
+		if now.After(a.lockedUntil) && now.Sub(a.lastFailure) > l.cooldown {
+			delete(l.attempts, username)
+		}
+	}
+}
+
+// Loader is a cache-aside helper: Get returns the cached value for a key or
+// calls the load function once, even if many goroutines miss at the same time
+type Loader[K comparable, V any] struct {
+	load     func(ctx context.Context, key K) (V, error)
+	cache    map[K]V
+	inflight map[K]*loadCall[V]
+	mu       sync.Mutex
+}
+
+// loadCall is a load in progress that concurrent callers wait on
+type loadCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// NewLoader creates a loader backed by the given load function
+func NewLoader[K comparable, V any](load func(ctx context.Context, key K) (V, error)) *Loader[K, V] {
+	return &Loader[K, V]{
+		load:     load,
+		cache:    make(map[K]V),
+		inflight: make(map[K]*loadCall[V]),
+	}
+}
+
+// Get returns the value for key, loading and caching it on a miss.
+// Failed loads are not cached.
+func (l *Loader[K, V]) Get(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	if value, ok := l.cache[key]; ok {
+		l.mu.Unlock()
+		return value, nil
+	}
+
+	call, loading := l.inflight[key]
+	if !loading {
+		call = &loadCall[V]{done: make(chan struct{})}
+		l.inflight[key] = call
+	}
+	l.mu.Unlock()
+
+	if !loading {
+		call.value, call.err = l.load(ctx, key)
+
+		l.mu.Lock()
+		// An Invalidate during the load means the value may be stale
+		if l.inflight[key] == call {
+			if call.err == nil {
+				l.cache[key] = call.value
+			}
+			delete(l.inflight, key)
+		}
+		l.mu.Unlock()
+
+		close(call.done)
+	}
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// Invalidate drops a cached value so the next Get reloads it. A load
+// already running for key is not cached.
+func (l *Loader[K, V]) Invalidate(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.cache, key)
+	delete(l.inflight, key)
+}
+
+// === SERVICES ===
+
+// UserService holds the rules for creating, updating and logging in users:
+// validation, password hashing and duplicate detection. Handlers translate
+// HTTP to these calls and map the errors back to status codes.
+type UserService struct {
+	repo   UserRepository
+	hasher PasswordHasher
+}
+
+// NewUserService creates a user service on top of repo
+func NewUserService(repo UserRepository, hasher PasswordHasher) *UserService {
+	return &UserService{repo: repo, hasher: hasher}
+}
+
+// Create validates req and stores the new user. It returns
+// ValidationErrors for bad input and ErrDuplicateUser if the username
+// or email is taken.
+func (s *UserService) Create(ctx context.Context, req CreateUserRequest) (*User, error) {
+	user, err := s.newUser(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateContext(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateMany validates every request before hashing any password, then
+// creates all the users in one transaction or none of them
+func (s *UserService) CreateMany(ctx context.Context, reqs []CreateUserRequest) ([]*User, error) {
+	// Fields are keyed by their position in the batch, e.g. "[2].email"
+	problems := ValidationErrors{}
+	for i, req := range reqs {
+		for field, msg := range validateCreateUser(req) {
+			problems[fmt.Sprintf("[%d].%s", i, field)] = msg
+		}
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	users := make([]*User, len(reqs))
+	for i, req := range reqs {
+		user, err := s.newUser(req)
+		if err != nil {
+			return nil, err
+		}
+		users[i] = user
+	}
+
+	if err := s.repo.BatchCreateContext(ctx, users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// newUser validates req and builds a user with its password hashed
+func (s *UserService) newUser(req CreateUserRequest) (*User, error) {
+	if errs := validateCreateUser(req); len(errs) > 0 {
+		return nil, errs
+	}
+
+	hash, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return &User{Username: req.Username, Email: req.Email, Password: hash}, nil
+}
+
+// Replace sets both the username and email of user id (PUT). Missing
+// fields are reported as ValidationErrors.
+func (s *UserService) Replace(ctx context.Context, id int, req UpdateUserRequest) (*User, error) {
+	if errs := req.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return s.update(ctx, id, func(user *User) {
+		user.Username = req.Username
+		user.Email = req.Email
+	})
+}
+
+// Patch changes only the fields present in req (PATCH)
+func (s *UserService) Patch(ctx context.Context, id int, req PatchUserRequest) (*User, error) {
+	if errs := req.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return s.update(ctx, id, func(user *User) {
+		if req.Username != nil {
+			user.Username = *req.Username
+		}
+		if req.Email != nil {
+			user.Email = *req.Email
+		}
+	})
+}
+
+// update loads user id, lets apply modify it and saves it
+func (s *UserService) update(ctx context.Context, id int, apply func(user *User)) (*User, error) {
+	user, err := s.repo.GetByIDContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	apply(user)
+
+	if err := s.repo.UpdateContext(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Login returns the user if password matches, or ErrInvalidCredentials
+func (s *UserService) Login(ctx context.Context, username, password string) (*User, error) {
+	user, err := s.repo.GetByUsernameContext(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.hasher.Compare(user.Password, password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// === HANDLERS ===
+
+// UserHandler handles user-related HTTP requests
+type UserHandler struct {
+	userRepo     UserRepository
+	tokens       TokenStore
+	users        *UserService
+	tokenService *TokenService
+	loginLimiter *LoginLimiter
+	logger       Logger
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(userRepo UserRepository, users *UserService, tokens TokenStore,
+	tokenService *TokenService, logger Logger) *UserHandler {
+	return &UserHandler{
+		userRepo:     userRepo,
+		users:        users,
+		tokens:       tokens,
+		tokenService: tokenService,
+		loginLimiter: NewLoginLimiter(5, 15*time.Minute),
+		logger:       logger,
+	}
+}
+
+// GetUsers handles GET /api/users
+func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("stream") == "true" {
+		h.logger.Info("Streaming all users")
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := h.StreamUsers(r.Context(), w); err != nil {
+			// Headers are already sent, so the best we can do is log
+			h.logger.Error("Failed to stream users", "error", err)
+		}
+		return
+	}
+
+	offset, limit, err := parsePagination(r)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid pagination", err.Error())
+		return
+	}
+
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+
+	h.logger.Info("Getting users", "offset", offset, "limit", limit, "include_deleted", includeDeleted)
+
+	queryStart := time.Now()
+	users, total, err := h.userRepo.GetPaginatedContext(r.Context(), limit, offset, includeDeleted)
+	RequestMetricsFromContext(r.Context()).RecordTiming("db.users.get_paginated", time.Since(queryStart))
+	if err != nil {
+		h.logger.Error("Failed to get users", "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to get users", err.Error())
+		return
+	}
+
+	// Convert to response format
+	var userResponses []UserResponse
+	for _, user := range users {
+		userResponses = append(userResponses, UserResponse{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+			DeletedAt: user.DeletedAt,
+		})
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	h.writeJSON(w, http.StatusOK, Page[UserResponse]{
+		Items:   append([]UserResponse{}, userResponses...),
+		Total:   total,
+		Offset:  offset,
+		Limit:   limit,
+		HasMore: offset+len(userResponses) < total,
+	})
+}
+
+// StreamUsers writes all users to w as a single Page, one item at a time,
+// so large tables never have to be held in memory. The output matches the
+// buffered path for a page holding every user.
+func (h *UserHandler) StreamUsers(ctx context.Context, w io.Writer) error {
+	if _, err := io.WriteString(w, `{"items":[`); err != nil {
+		return err
+	}
+
+	count := 0
+	err := h.userRepo.Iterate(ctx, func(user User) error {
+		item, err := json.Marshal(UserResponse{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+			DeletedAt: user.DeletedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode user %d: %w", user.ID, err)
+		}
+		if count > 0 {
+			item = append([]byte{','}, item...)
+		}
+		count++
+		_, err = w.Write(item)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The rest of Page's fields, in the order its JSON tags declare them
+	_, err = fmt.Fprintf(w, `],"total":%d,"offset":0,"limit":%d,"has_more":false}`+"\n", count, count)
+	return err
+}
+
+// GetUser handles GET /api/users/{id}
+func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	h.logger.Info("Getting user", "id", id)
+
+	user, err := h.userRepo.GetByIDContext(r.Context(), id)
+	if err != nil {
+		h.logger.Error("Failed to get user", "id", id, "error", err)
+		h.writeError(w, http.StatusNotFound, "User not found", err.Error())
+		return
+	}
+
+	userResponse := UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+
+	h.writeJSON(w, http.StatusOK, userResponse)
+}
+
+// CreateUser handles POST /api/users
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	req, err := strictDecode[CreateUserRequest](r.Body)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	h.logger.Info("Creating user", "username", req.Username)
+
+	user, err := h.users.Create(r.Context(), req)
+	if err != nil {
+		h.writeUserError(w, err, "Failed to create user")
+		return
+	}
+	RequestMetricsFromContext(r.Context()).IncCounter("users.created", 1)
+
+	userResponse := UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+
+	h.writeJSON(w, http.StatusCreated, userResponse)
+}
+
+// importBatchSize is how many CSV rows are inserted per transaction
+const importBatchSize = 100
+
+// ImportRowError describes why a single CSV row was not imported
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// maxBatchCreate caps how many users one batch request may create
+const maxBatchCreate = 100
+
+// BatchCreateResponse is the response body of a batch create
+type BatchCreateResponse struct {
+	IDs []int `json:"ids"`
+}
+
+// BatchCreateUsers handles POST /api/users/batch. It takes a JSON array
+// of create requests and inserts them atomically: either every user is
+// created or none is.
+func (h *UserHandler) BatchCreateUsers(w http.ResponseWriter, r *http.Request) {
+	reqs, err := strictDecode[[]CreateUserRequest](r.Body)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchCreate {
+		h.writeError(w, http.StatusBadRequest, "Invalid batch size",
+			fmt.Sprintf("expected 1 to %d users, got %d", maxBatchCreate, len(reqs)))
+		return
+	}
+
+	h.logger.Info("Batch creating users", "count", len(reqs))
+
+	users, err := h.users.CreateMany(r.Context(), reqs)
+	if err != nil {
+		h.writeUserError(w, err, "Failed to create users")
+		return
+	}
+	RequestMetricsFromContext(r.Context()).IncCounter("users.created", int64(len(users)))
+
+	ids := make([]int, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	h.writeJSON(w, http.StatusCreated, BatchCreateResponse{IDs: ids})
+}
+
+// ImportSummary is the response body of a CSV import
+type ImportSummary struct {
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors,omitempty"`
+}
+
+// ImportUsers handles POST /api/users/import.
+// It expects a multipart upload with a "file" part containing CSV with a
+// username,email,password header, and streams it row by row.
+func (h *UserHandler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Expected multipart upload", err.Error())
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			h.writeError(w, http.StatusBadRequest, "Missing file", "multipart field \"file\" is required")
+			return
+		}
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "Invalid multipart upload", err.Error())
+			return
+		}
+
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		summary, err := h.importCSV(r.Context(), part)
+		part.Close()
+		if err != nil {
+			h.logger.Error("Failed to import users", "error", err)
+			h.writeError(w, http.StatusBadRequest, "Failed to import users", err.Error())
+			return
+		}
+
+		h.logger.Info("Imported users", "imported", summary.Imported, "failed", summary.Failed)
+		metrics := RequestMetricsFromContext(r.Context())
+		metrics.IncCounter("users.imported", int64(summary.Imported))
+		metrics.IncCounter("users.import_failed", int64(summary.Failed))
+		h.writeJSON(w, http.StatusOK, summary)
+		return
+	}
+}
+
+// importCSV validates rows as they are read and inserts them in batches
+func (h *UserHandler) importCSV(ctx context.Context, src io.Reader) (*ImportSummary, error) {
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = -1 // row length is checked against the header below
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"username", "email", "password"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing column %q", required)
+		}
+	}
+
+	summary := &ImportSummary{}
+	fail := func(row int, msg string) {
+		summary.Failed++
+		summary.Errors = append(summary.Errors, ImportRowError{Row: row, Error: msg})
+	}
+
+	var batch []*User
+	var batchRows []int
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := h.userRepo.BatchCreateContext(ctx, batch); err == nil {
+			summary.Imported += len(batch)
+			batch, batchRows = nil, nil
+			return
+		}
+
+		// One bad row rolls back the whole batch, so insert the rows one
+		// at a time to keep the good ones and report each failure
+		for i, user := range batch {
+			if err := h.userRepo.CreateContext(ctx, user); err != nil {
+				fail(batchRows[i], err.Error())
+				continue
+			}
+			summary.Imported++
+		}
+		batch, batchRows = nil, nil
+	}
+
+	for row := 2; ; row++ { // row 1 is the header
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				fail(row, err.Error())
+				continue
+			}
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		if len(record) != len(header) {
+			fail(row, fmt.Sprintf("expected %d fields, got %d", len(header), len(record)))
+			continue
+		}
+
+		req := CreateUserRequest{
+			Username: strings.TrimSpace(record[columns["username"]]),
+			Email:    strings.TrimSpace(record[columns["email"]]),
+			Password: record[columns["password"]],
+		}
+		user, err := h.users.newUser(req)
+		if err != nil {
+			fail(row, err.Error())
+			continue
+		}
+
+		batch = append(batch, user)
+		batchRows = append(batchRows, row)
+		if len(batch) >= importBatchSize {
+			flush()
+		}
+	}
+	flush()
+
+	return summary, nil
+}
+
+// UpdateUser handles PUT /api/users/{id}
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	idStr := vars["id"]
 
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
-		return
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	req, err := strictDecode[UpdateUserRequest](r.Body)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	h.logger.Info("Updating user", "id", id)
+
+	// PUT replaces the user, so every field must be present
+	user, err := h.users.Replace(r.Context(), id, req)
+	if err != nil {
+		h.writeUserError(w, err, "Failed to update user")
+		return
+	}
+
+	userResponse := UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+
+	h.writeJSON(w, http.StatusOK, userResponse)
+}
+
+// PatchUser handles PATCH /api/users/{id}, changing only the fields sent
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	req, err := strictDecode[PatchUserRequest](r.Body)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	h.logger.Info("Patching user", "id", id)
+
+	user, err := h.users.Patch(r.Context(), id, req)
+	if err != nil {
+		h.writeUserError(w, err, "Failed to update user")
+		return
+	}
+
+	userResponse := UserResponse{
+		ID:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+
+	h.writeJSON(w, http.StatusOK, userResponse)
+}
+
+// DeleteUser handles DELETE /api/users/{id}
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	idStr := vars["id"]
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	h.logger.Info("Deleting user", "id", id)
+
+	if err := h.userRepo.DeleteContext(r.Context(), id); err != nil {
+		h.logger.Error("Failed to delete user", "id", id, "error", err)
+		h.writeError(w, http.StatusNotFound, "User not found", err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreUser handles POST /api/users/{id}/restore, undoing a delete
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
+		return
+	}
+
+	h.logger.Info("Restoring user", "id", id)
+
+	if err := h.userRepo.RestoreContext(r.Context(), id); err != nil {
+		h.writeUserError(w, err, "Failed to restore user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Login handles POST /api/auth/login
+func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	h.logger.Info("User login attempt", "username", req.Username)
+
+	if wait := h.loginLimiter.LockedFor(req.Username); wait > 0 {
+		h.logger.Error("Login rejected - account locked", "username", req.Username)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		h.writeError(w, http.StatusTooManyRequests, "Too many failed login attempts", "try again later")
+		return
+	}
+
+	user, err := h.users.Login(r.Context(), req.Username, req.Password)
+	if errors.Is(err, ErrInvalidCredentials) {
+		RequestMetricsFromContext(r.Context()).IncCounter("auth.login_failures", 1)
+		h.loginLimiter.RecordFailure(req.Username)
+		h.logger.Error("Login failed - invalid credentials", "username", req.Username)
+		h.writeError(w, http.StatusUnauthorized, "Invalid credentials", "")
+		return
+	}
+	if err != nil {
+		h.writeUserError(w, err, "Failed to log in")
+		return
+	}
+
+	h.loginLimiter.RecordSuccess(req.Username)
+
+	token, err := h.tokenService.Issue(user.ID)
+	if err != nil {
+		h.logger.Error("Failed to issue token", "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to log in", "")
+		return
+	}
+
+	response := LoginResponse{
+		User: UserResponse{
+			ID:        user.ID,
+			Username:  user.Username,
+			Email:     user.Email,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		},
+		Token: token,
+	}
+
+	h.writeJSON(w, http.StatusOK, response)
+}
+
+// Logout handles POST /api/auth/logout
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	token := bearerToken(r)
+	if token == "" {
+		h.writeError(w, http.StatusUnauthorized, "Missing token", "")
+		return
+	}
+
+	h.tokens.Revoke(token)
+
+	userID := MustGet[string](r.Context(), userIDKey)
+	h.logger.Info("User logged out", "user_id", userID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helper methods
+func (h *UserHandler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	Try(json.NewEncoder(w).Encode(data), h.logger)
+}
+
+func (h *UserHandler) writeError(w http.ResponseWriter, status int, message, details string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	Try(json.NewEncoder(w).Encode(APIError{
+		Error:   message,
+		Message: details,
+		Code:    status,
+	}), h.logger)
+}
+
+// writeUserError maps an error from UserService to a status code, logging
+// and answering 500 with message for anything unexpected
+func (h *UserHandler) writeUserError(w http.ResponseWriter, err error, message string) {
+	var errs ValidationErrors
+	switch {
+	case errors.As(err, &errs):
+		h.writeValidationErrors(w, errs)
+	case errors.Is(err, ErrUserNotFound):
+		h.writeError(w, http.StatusNotFound, "User not found", err.Error())
+	case errors.Is(err, ErrDuplicateUser):
+		h.writeError(w, http.StatusConflict, "User already exists", err.Error())
+	case errors.Is(err, ErrInvalidCredentials):
+		h.writeError(w, http.StatusUnauthorized, "Invalid credentials", "")
+	default:
+		h.logger.Error(message, "error", err)
+		h.writeError(w, http.StatusInternalServerError, message, err.Error())
+	}
+}
+
+func (h *UserHandler) writeValidationErrors(w http.ResponseWriter, errs ValidationErrors) {
+	h.writeJSON(w, http.StatusUnprocessableEntity, APIError{
+		Error:   "Validation failed",
+		Message: strings.Join(errs.Messages(), "; "),
+		Code:    http.StatusUnprocessableEntity,
+		Errors:  errs,
+	})
+}
+
+// healthHandler handles GET /health. It needs startTimeKey injected.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":    "ok",
+		"timestamp": time.Now().Format(time.RFC3339),
+		"uptime":    time.Since(MustGet[time.Time](r.Context(), startTimeKey)).Round(time.Second).String(),
+	})
+}
+
+// === METRICS ===
+
+// EMA is a concurrency-safe exponential moving average.
+// Higher alpha values react faster to new observations.
+type EMA struct {
+	alpha       float64
+	value       float64
+	initialized bool
+	mu          sync.Mutex
+}
+
+// NewEMA creates a moving average with smoothing factor alpha in (0, 1]
+func NewEMA(alpha float64) *EMA {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.1
+	}
+	return &EMA{alpha: alpha}
+}
+
+// Observe folds a new sample into the average
+func (e *EMA) Observe(v float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.initialized {
+		e.value = v
+		e.initialized = true
+		return
+	}
+
+	e.value = e.alpha*v + (1-e.alpha)*e.value
+}
+
+// Value returns the current average (0 before any observation)
+func (e *EMA) Value() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.value
+}
+
+// requestLatency tracks smoothed request latency in milliseconds
+var requestLatency = NewEMA(0.1)
+
+// TimingStats aggregates the durations recorded under one name
+type TimingStats struct {
+	Count int64         `json:"count"`
+	Total time.Duration `json:"total"`
+}
+
+// RequestMetrics collects counters and timings for a single request.
+// A nil *RequestMetrics ignores all calls, so code can annotate without
+// checking whether a collector is present.
+type RequestMetrics struct {
+	counters map[string]int64
+	timings  map[string]TimingStats
+	mu       sync.Mutex
+}
+
+// NewRequestMetrics creates an empty per-request collector
+func NewRequestMetrics() *RequestMetrics {
+	return &RequestMetrics{
+		counters: make(map[string]int64),
+		timings:  make(map[string]TimingStats),
+	}
+}
+
+// IncCounter adds delta to the named counter
+func (rm *RequestMetrics) IncCounter(name string, delta int64) {
+	if rm == nil {
+		return
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.counters[name] += delta
+}
+
+// RecordTiming adds one observation of d to the named timing
+func (rm *RequestMetrics) RecordTiming(name string, d time.Duration) {
+	if rm == nil {
+		return
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	stats := rm.timings[name]
+	stats.Count++
+	stats.Total += d
+	rm.timings[name] = stats
+}
+
+// MetricsRegistry is the process-wide store that request metrics are
+// flushed into when each request completes
+type MetricsRegistry struct {
+	counters map[string]int64
+	timings  map[string]TimingStats
+	mu       sync.RWMutex
+}
+
+// NewMetricsRegistry creates an empty registry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		counters: make(map[string]int64),
+		timings:  make(map[string]TimingStats),
+	}
+}
+
+// Merge folds a finished request's metrics into the registry
+func (m *MetricsRegistry) Merge(rm *RequestMetrics) {
+	if rm == nil {
+		return
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, delta := range rm.counters {
+		m.counters[name] += delta
+	}
+	for name, stats := range rm.timings {
+		total := m.timings[name]
+		total.Count += stats.Count
+		total.Total += stats.Total
+		m.timings[name] = total
+	}
+}
+
+// Counter returns the current value of the named counter
+func (m *MetricsRegistry) Counter(name string) int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.counters[name]
+}
+
+// Timing returns the aggregated stats for the named timing
+func (m *MetricsRegistry) Timing(name string) TimingStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.timings[name]
+}
+
+// globalMetrics receives every request's metrics from LoggingMiddleware
+var globalMetrics = NewMetricsRegistry()
+
+// InFlightGauge counts requests that are currently being served
+type InFlightGauge struct {
+	count atomic.Int64
+}
+
+// Current returns the number of requests in flight
+func (g *InFlightGauge) Current() int64 {
+	return g.count.Load()
+}
+
+// Wait blocks until no requests are in flight or ctx is done
+func (g *InFlightGauge) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for g.Current() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests still in flight: %w", g.Current(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// inFlightRequests is maintained by the InFlight middleware
+var inFlightRequests = &InFlightGauge{}
+
+// responseSizeBuckets are the histogram upper bounds in bytes: 1KB, then x4
+var responseSizeBuckets = []int64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// ByteSizeHistogram counts observed sizes into exponential buckets.
+// Sizes above the largest bound land in an overflow bucket.
+type ByteSizeHistogram struct {
+	bounds []int64
+	counts []int64 // len(bounds)+1, the last entry is the overflow bucket
+	sum    int64
+	total  int64
+	mu     sync.Mutex
+}
+
+// HistogramBucket is one bucket in a histogram snapshot. UpperBound is -1
+// for the overflow bucket.
+type HistogramBucket struct {
+	UpperBound int64 `json:"le"`
+	Count      int64 `json:"count"`
+}
+
+// HistogramSnapshot is a point-in-time copy of a ByteSizeHistogram
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   int64             `json:"count"`
+	Sum     int64             `json:"sum"`
+}
+
+// NewByteSizeHistogram creates a histogram with the given ascending bounds
+func NewByteSizeHistogram(bounds []int64) *ByteSizeHistogram {
+	return &ByteSizeHistogram{
+		bounds: bounds,
+		counts: make([]int64, len(bounds)+1),
+	}
+}
+
+// Observe records one size; a size equal to a bound belongs to that bucket
+func (h *ByteSizeHistogram) Observe(size int64) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return size <= h.bounds[i] })
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += size
+	h.total++
+}
+
+// Snapshot returns the current bucket counts, total count and byte sum
+func (h *ByteSizeHistogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make([]HistogramBucket, len(h.counts))
+	for i, count := range h.counts {
+		bound := int64(-1)
+		if i < len(h.bounds) {
+			bound = h.bounds[i]
+		}
+		buckets[i] = HistogramBucket{UpperBound: bound, Count: count}
+	}
+	return HistogramSnapshot{Buckets: buckets, Count: h.total, Sum: h.sum}
+}
+
+// responseSizes records the body size of every response
+var responseSizes = NewByteSizeHistogram(responseSizeBuckets)
+
+// Metrics counts served requests by status class along with the total
+// time spent serving them. All fields are updated atomically.
+type Metrics struct {
+	requests      atomic.Int64
+	statusClasses [6]atomic.Int64 // indexed by status/100; 0 collects out-of-range codes
+	durationNanos atomic.Int64
+}
+
+// MetricsSnapshot is the JSON form of Metrics
+type MetricsSnapshot struct {
+	Requests      int64            `json:"requests_total"`
+	Status        map[string]int64 `json:"status"`
+	DurationSum   float64          `json:"duration_seconds_sum"`
+	DurationCount int64            `json:"duration_seconds_count"`
+}
+
+// Observe records one finished request
+func (m *Metrics) Observe(status int, d time.Duration) {
+	class := status / 100
+	if class < 1 || class >= len(m.statusClasses) {
+		class = 0
+	}
+	m.statusClasses[class].Add(1)
+	m.durationNanos.Add(int64(d))
+	m.requests.Add(1)
+}
+
+// Snapshot returns the current counters; status classes that never
+// occurred are omitted
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	status := make(map[string]int64)
+	for class := range m.statusClasses {
+		if count := m.statusClasses[class].Load(); count > 0 {
+			name := "other"
+			if class > 0 {
+				name = fmt.Sprintf("%dxx", class)
+			}
+			status[name] = count
+		}
+	}
+
+	requests := m.requests.Load()
+	return MetricsSnapshot{
+		Requests:      requests,
+		Status:        status,
+		DurationSum:   time.Duration(m.durationNanos.Load()).Seconds(),
+		DurationCount: requests,
+	}
+}
+
+// httpMetrics is maintained by MetricsMiddleware
+var httpMetrics = &Metrics{}
+
+// MetricsHandler reports the process-wide request metrics as JSON
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"http":           httpMetrics.Snapshot(),
+		"in_flight":      inFlightRequests.Current(),
+		"response_bytes": responseSizes.Snapshot(),
+	})
+}
+
+// === MIDDLEWARE ===
+
+// responseWriter wraps http.ResponseWriter to record the status code and
+// bytes written. Every middleware that needs those shares this one type.
+type responseWriter struct {
+	http.ResponseWriter
+	status       int
+	bytesWritten int64
+	wroteHeader  bool
+	body         *bytes.Buffer // non-nil only while a middleware captures the body
+}
+
+// wrapResponseWriter returns w wrapped for status/byte capture
+func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytesWritten += int64(n)
+	if rw.body != nil {
+		rw.body.Write(b[:n])
+	}
+	return n, err
+}
+
+// CaptureBody starts recording everything written from now on and returns
+// the buffer it is recorded into
+func (rw *responseWriter) CaptureBody() *bytes.Buffer {
+	if rw.body == nil {
+		rw.body = &bytes.Buffer{}
+	}
+	return rw.body
+}
+
+// Status returns the response status code (200 if none was set explicitly)
+func (rw *responseWriter) Status() int {
+	return rw.status
+}
+
+// BytesWritten returns the number of body bytes written so far
+func (rw *responseWriter) BytesWritten() int64 {
+	return rw.bytesWritten
+}
+
+// Flush forwards to the underlying writer when it supports streaming
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack forwards to the underlying writer when it supports connection takeover
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("underlying ResponseWriter does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the original writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// LoggingMiddleware logs HTTP requests
+func LoggingMiddleware(logger Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			requestID, _ := Get[string](r.Context(), requestIDKey)
+			logger.Info("Request started", "request_id", requestID, "method", r.Method, "path", r.URL.Path)
+
+			rm := NewRequestMetrics()
+			rw := wrapResponseWriter(w)
+			next.ServeHTTP(rw, r.WithContext(WithValue(r.Context(), requestMetricsKey, rm)))
+
+			duration := time.Since(start)
+			requestLatency.Observe(float64(duration) / float64(time.Millisecond))
+			responseSizes.Observe(rw.BytesWritten())
+			globalMetrics.Merge(rm)
+
+			logger.Info("Request completed",
+				"request_id", requestID,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rw.Status(),
+				"bytes", rw.BytesWritten(),
+				"duration", duration,
+				"avg_latency_ms", requestLatency.Value())
+		})
+	}
+}
+
+// AuthMiddleware rejects requests without a valid, unexpired and
+// unrevoked bearer token, and stores the token's user ID in the context
+func AuthMiddleware(tokenService *TokenService, tokens TokenStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := bearerToken(r)
+			userID, err := tokenService.Verify(token)
+
+			var message string
+			switch {
+			case token == "":
+				message = "Missing token"
+			case errors.Is(err, ErrTokenExpired):
+				message = "Token has expired"
+			case err != nil:
+				message = "Invalid token"
+			case tokens.IsRevoked(token):
+				message = "Token has been revoked"
+			}
+
+			if message != "" {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(APIError{
+					Error: message,
+					Code:  http.StatusUnauthorized,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithValue(r.Context(), userIDKey, strconv.Itoa(userID))))
+		})
+	}
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+// contextKey is unexported so other packages can't collide with our keys
+type contextKey int
+
+const (
+	userIDKey contextKey = iota
+	requestMetricsKey
+	requestIDKey
+	startTimeKey
+)
+
+// WithValue returns a copy of ctx carrying value under key
+func WithValue[T any](ctx context.Context, key contextKey, value T) context.Context {
+	return context.WithValue(ctx, key, value)
+}
+
+// Get returns the T stored under key, if any
+func Get[T any](ctx context.Context, key contextKey) (T, bool) {
+	value, ok := ctx.Value(key).(T)
+	return value, ok
+}
+
+// MustGet returns the T stored under key, panicking if it is missing.
+// Only use it for values a middleware is guaranteed to have injected.
+func MustGet[T any](ctx context.Context, key contextKey) T {
+	value, ok := Get[T](ctx, key)
+	if !ok {
+		panic(fmt.Sprintf("context value for key %v is missing or not a %T", key, value))
+	}
+	return value
+}
+
+// Inject returns middleware that stores value under key in every request context
+func Inject[T any](key contextKey, value T) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(w, r.WithContext(WithValue(r.Context(), key, value)))
+		}
 	}
+}
 
-	var req UpdateUserRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body", err.Error())
-		return
+// RequestMetricsFromContext returns the request's collector, or nil (which
+// is safe to call methods on) when there is none
+func RequestMetricsFromContext(ctx context.Context) *RequestMetrics {
+	rm, _ := Get[*RequestMetrics](ctx, requestMetricsKey)
+	return rm
+}
+
+// AccessLogFormat selects how AccessLogMiddleware renders each request
+type AccessLogFormat int
+
+const (
+	AccessLogOff AccessLogFormat = iota
+	// AccessLogCommon is the NCSA Common Log Format:
+	// host ident authuser [date] "request" status bytes
+	AccessLogCommon
+	// AccessLogCombined is Common plus "referer" "user-agent"
+	AccessLogCombined
+)
+
+func (f AccessLogFormat) String() string {
+	switch f {
+	case AccessLogCommon:
+		return "common"
+	case AccessLogCombined:
+		return "combined"
+	default:
+		return "off"
 	}
+}
 
-	h.logger.Info("Updating user", "id", id)
+// ParseAccessLogFormat maps "off", "common" or "combined" to a format
+func ParseAccessLogFormat(name string) (AccessLogFormat, error) {
+	switch strings.ToLower(name) {
+	case "", "off":
+		return AccessLogOff, nil
+	case "common":
+		return AccessLogCommon, nil
+	case "combined":
+		return AccessLogCombined, nil
+	default:
+		return AccessLogOff, fmt.Errorf("unknown access log format %q", name)
+	}
+}
 
-	// Get existing user
-	user, err := h.userRepo.GetByID(id)
+// FormatAccessLog renders one request in the given format (without a
+// trailing newline). Missing values are written as "-" per the spec.
+func FormatAccessLog(format AccessLogFormat, r *http.Request, status int, bytes int64, at time.Time) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		h.logger.Error("Failed to get user for update", "id", id, "error", err)
-		h.writeError(w, http.StatusNotFound, "User not found", err.Error())
-		return
+		host = r.RemoteAddr
 	}
 
-	// Update fields
-	if req.Username != "" {
-		user.Username = req.Username
-	}
-	if req.Email != "" {
-		user.Email = req.Email
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
 	}
 
-	if err := h.userRepo.Update(user); err != nil {
-		h.logger.Error("Failed to update user", "id", id, "error", err)
-		h.writeError(w, http.StatusInternalServerError, "Failed to update user", err.Error())
-		return
+	line := fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s`,
+		orDash(host), at.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.URL.RequestURI(), r.Proto, status, size)
+
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(` "%s" "%s"`, quoteLogField(r.Referer()), quoteLogField(r.UserAgent()))
 	}
+	return line
+}
 
-	userResponse := UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+func orDash(s string) string {
+	if s == "" {
+		return "-"
 	}
+	return s
+}
 
-	h.writeJSON(w, http.StatusOK, userResponse)
+// quoteLogField escapes a value for use inside a quoted log field
+func quoteLogField(s string) string {
+	return strings.ReplaceAll(orDash(s), `"`, `\"`)
 }
 
-// DeleteUser handles DELETE /api/users/{id}
-func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	idStr := vars["id"]
+// AccessLogMiddleware writes one access log line per request to out
+func AccessLogMiddleware(format AccessLogFormat, out io.Writer) func(http.Handler) http.Handler {
+	var mu sync.Mutex // keep concurrent lines from interleaving
 
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid user ID", err.Error())
-		return
-	}
+	return func(next http.Handler) http.Handler {
+		if format == AccessLogOff {
+			return next
+		}
 
-	h.logger.Info("Deleting user", "id", id)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := wrapResponseWriter(w)
+			next.ServeHTTP(rw, r)
 
-	if err := h.userRepo.Delete(id); err != nil {
-		h.logger.Error("Failed to delete user", "id", id, "error", err)
-		h.writeError(w, http.StatusNotFound, "User not found", err.Error())
-		return
+			line := FormatAccessLog(format, r, rw.Status(), rw.BytesWritten(), start)
+			mu.Lock()
+			fmt.Fprintln(out, line)
+			mu.Unlock()
+		})
 	}
-
-	w.WriteHeader(http.StatusNoContent)
 }
 
-// Login handles POST /api/auth/login
-func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
+// RequireContentType rejects requests whose Content-Type media type isn't
+// mediaType with 415 Unsupported Media Type. Parameters such as charset
+// are ignored.
+func RequireContentType(mediaType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || !strings.EqualFold(got, mediaType) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				json.NewEncoder(w).Encode(APIError{
+					Error:   "Unsupported content type",
+					Code:    http.StatusUnsupportedMediaType,
+					Message: fmt.Sprintf("expected %s", mediaType),
+				})
+				return
+			}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.writeError(w, http.StatusBadRequest, "Invalid request body", err.Error())
-		return
+			next.ServeHTTP(w, r)
+		})
 	}
+}
 
-	h.logger.Info("User login attempt", "username", req.Username)
+// InFlight tracks the number of active requests in gauge. The decrement is
+// deferred so a panicking handler still releases its slot.
+func InFlight(gauge *InFlightGauge) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gauge.count.Add(1)
+			defer gauge.count.Add(-1)
 
-	user, err := h.userRepo.GetByUsername(req.Username)
-	if err != nil {
-		h.logger.Error("Login failed - user not found", "username", req.Username)
-		h.writeError(w, http.StatusUnauthorized, "Invalid credentials", "")
-		return
+			next.ServeHTTP(w, r)
+		})
 	}
+}
 
-	// In production, use proper password hashing
-	if user.Password != req.Password {
-		h.logger.Error("Login failed - invalid password", "username", req.Username)
-		h.writeError(w, http.StatusUnauthorized, "Invalid credentials", "")
-		return
-	}
+// requestIDHeader carries the request ID in and out of the service
+const requestIDHeader = "X-Request-ID"
 
-	// Generate simple token (in production, use JWT)
-	token := fmt.Sprintf("token_%d_%d", user.ID, time.Now().Unix())
+// maxRequestIDLength bounds client-supplied IDs so they can't bloat logs
+const maxRequestIDLength = 128
 
-	response := LoginResponse{
-		User: UserResponse{
-			ID:        user.ID,
-			Username:  user.Username,
-			Email:     user.Email,
-			CreatedAt: user.CreatedAt,
-			UpdatedAt: user.UpdatedAt,
-		},
-		Token: token,
-	}
+// RequestIDMiddleware reuses a well-formed incoming X-Request-ID or
+// generates a UUID, stores it in the request context and echoes it on the
+// response
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newUUID()
+		}
 
-	h.writeJSON(w, http.StatusOK, response)
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithValue(r.Context(), requestIDKey, id)))
+	})
 }
 
-// Helper methods
-func (h *UserHandler) writeJSON(w http.ResponseWriter, status int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+// validRequestID accepts non-empty, bounded IDs of printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
 }
 
-func (h *UserHandler) writeError(w http.ResponseWriter, status int, message, details string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(APIError{
-		Error:   message,
-		Message: details,
-		Code:    status,
-	})
+// newUUID returns a random RFC 4122 version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:]) // never returns an error
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
-// === MIDDLEWARE ===
-
-// LoggingMiddleware logs HTTP requests
-func LoggingMiddleware(logger Logger) func(http.Handler) http.Handler {
+// MetricsMiddleware records every request's status and duration in m
+func MetricsMiddleware(m *Metrics) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			logger.Info("Request started", "method", r.Method, "path", r.URL.Path)
-
-			next.ServeHTTP(w, r)
-
-			logger.Info("Request completed",
-				"method", r.Method,
-				"path", r.URL.Path,
-				"duration", time.Since(start))
+			rw := wrapResponseWriter(w)
+			next.ServeHTTP(rw, r)
+			m.Observe(rw.Status(), time.Since(start))
 		})
 	}
 }
@@ -577,8 +3008,8 @@ func LoggingMiddleware(logger Logger) func(http.Handler) http.Handler {
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -589,29 +3020,320 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// === DATABASE SETUP ===
+// cachedResponse is a completed response kept for idempotent replay
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
 
-// SetupDatabase creates and initializes the database
-func SetupDatabase() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", "users.db")
+// idempotencyEntry is what a key maps to: the body it was first used with
+// and, once that request has finished, its response
+type idempotencyEntry struct {
+	bodyHash  [sha256.Size]byte
+	response  *cachedResponse // nil while the first request is running
+	expiresAt time.Time
+}
+
+var (
+	// ErrIdempotencyInFlight is returned by begin while the first request
+	// with a key is still running
+	ErrIdempotencyInFlight = errors.New("request with this idempotency key is in progress")
+	// ErrIdempotencyMismatch is returned by begin when a key is reused with
+	// a different request body
+	ErrIdempotencyMismatch = errors.New("idempotency key reused with a different request body")
+)
+
+// IdempotencyStore remembers responses by Idempotency-Key for a TTL
+type IdempotencyStore struct {
+	entries map[string]*idempotencyEntry
+	ttl     time.Duration
+	mu      sync.Mutex
+}
+
+// NewIdempotencyStore creates a store that replays responses for ttl
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		ttl:     ttl,
+	}
+}
+
+// begin returns the cached response for key, or reserves the key for the
+// caller and returns nil. It fails if the key is in flight or was first
+// used with a different body.
+func (s *IdempotencyStore) begin(key string, bodyHash [sha256.Size]byte) (*cachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if entry, exists := s.entries[key]; exists && now.Before(entry.expiresAt) {
+		switch {
+		case entry.bodyHash != bodyHash:
+			return nil, ErrIdempotencyMismatch
+		case entry.response == nil:
+			return nil, ErrIdempotencyInFlight
+		default:
+			return entry.response, nil
+		}
+	}
+
+	s.entries[key] = &idempotencyEntry{bodyHash: bodyHash, expiresAt: now.Add(s.ttl)}
+	return nil, nil
+}
+
+// finish stores the response for key, or releases the reservation when the
+// response shouldn't be replayed (e.g. a server error worth retrying)
+func (s *IdempotencyStore) finish(key string, response *cachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists {
+		return
+	}
+	if response == nil {
+		delete(s.entries, key)
+		return
+	}
+	entry.response = response
+	entry.expiresAt = time.Now().Add(s.ttl)
+}
+
+// Sweep drops every expired entry, including keys that never come back
+func (s *IdempotencyStore) Sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// idempotencyCaller identifies who sent r, so two clients picking the same
+// key never see each other's responses: the bearer token when there is
+// one, otherwise the client address
+func idempotencyCaller(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "auth:" + hex.EncodeToString(sum[:])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// maxIdempotentBodyBytes caps the request body buffered for hashing
+const maxIdempotentBodyBytes = 1 << 20
+
+// perRequestHeaders are set afresh by outer middleware for every request,
+// so a replay keeps the current request's values instead of the cached ones
+var perRequestHeaders = []string{
+	requestIDHeader,
+	"Access-Control-Allow-Origin",
+	"Access-Control-Allow-Methods",
+	"Access-Control-Allow-Headers",
+}
+
+// IdempotencyMiddleware replays the stored response when a non-safe request
+// repeats an Idempotency-Key, so double-submitted forms run the handler once.
+// Keys are scoped to the caller and endpoint, and reusing one with a
+// different body is rejected with 422. Multipart uploads are streamed by
+// their handlers and pass through without replay; other bodies over
+// maxIdempotentBodyBytes are rejected with 413.
+func IdempotencyMiddleware(store *IdempotencyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get("Idempotency-Key")
+			if idempotencyKey == "" || r.Method == http.MethodGet ||
+				r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+				strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			payload, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodyBytes+1))
+			if err != nil {
+				writeIdempotencyError(w, http.StatusBadRequest, "Failed to read request body")
+				return
+			}
+			if len(payload) > maxIdempotentBodyBytes {
+				writeIdempotencyError(w, http.StatusRequestEntityTooLarge, "Request body too large for an Idempotency-Key")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(payload))
+
+			key := idempotencyCaller(r) + " " + r.Method + " " + r.URL.Path + " " + idempotencyKey
+
+			cached, err := store.begin(key, sha256.Sum256(payload))
+			switch {
+			case errors.Is(err, ErrIdempotencyInFlight):
+				writeIdempotencyError(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+				return
+			case errors.Is(err, ErrIdempotencyMismatch):
+				writeIdempotencyError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+				return
+			case cached != nil:
+				for name, values := range cached.header {
+					w.Header()[name] = values
+				}
+				w.Header().Set("Idempotency-Replayed", "true")
+				w.WriteHeader(cached.status)
+				w.Write(cached.body)
+				return
+			}
+
+			rw := wrapResponseWriter(w)
+			body := rw.CaptureBody()
+			start := body.Len()
+
+			next.ServeHTTP(rw, r)
+
+			if rw.Status() >= http.StatusInternalServerError {
+				store.finish(key, nil)
+				return
+			}
+			header := rw.Header().Clone()
+			for _, name := range perRequestHeaders {
+				header.Del(name)
+			}
+			store.finish(key, &cachedResponse{
+				status: rw.Status(),
+				header: header,
+				body:   bytes.Clone(body.Bytes()[start:]),
+			})
+		})
 	}
+}
+
+func writeIdempotencyError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIError{Error: message, Code: status})
+}
+
+// === DATABASE SETUP ===
+
+// Migration is a single, versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// migrations lists every schema change in the order it must be applied.
+// Append new entries; never edit or reorder ones that have shipped.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_users",
+		SQL: `
+			CREATE TABLE IF NOT EXISTS users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username TEXT UNIQUE NOT NULL,
+				email TEXT UNIQUE NOT NULL,
+				password TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			)
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "add_users_deleted_at",
+		SQL:     `ALTER TABLE users ADD COLUMN deleted_at DATETIME`,
+	},
+	{
+		// Soft-deleted rows must not hold on to their username and email,
+		// so uniqueness only applies to live users. SQLite can't drop a
+		// column constraint, hence the table rebuild.
+		Version: 3,
+		Name:    "unique_active_users",
+		SQL: `
+			CREATE TABLE users_new (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				username TEXT NOT NULL,
+				email TEXT NOT NULL,
+				password TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL,
+				deleted_at DATETIME
+			);
+			INSERT INTO users_new (id, username, email, password, created_at, updated_at, deleted_at)
+				SELECT id, username, email, password, created_at, updated_at, deleted_at FROM users;
+			DROP TABLE users;
+			ALTER TABLE users_new RENAME TO users;
+			CREATE UNIQUE INDEX users_username_active ON users (username) WHERE deleted_at IS NULL;
+			CREATE UNIQUE INDEX users_email_active ON users (email) WHERE deleted_at IS NULL;
+		`,
+	},
+}
 
-	// Create users table
+// RunMigrations applies any migrations not yet recorded in schema_migrations.
+// Each migration runs in its own transaction, so running it twice is a no-op.
+func RunMigrations(db *sql.DB, migrations []Migration) error {
 	createTableQuery := `
-		CREATE TABLE IF NOT EXISTS users (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			username TEXT UNIQUE NOT NULL,
-			email TEXT UNIQUE NOT NULL,
-			password TEXT NOT NULL,
-			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
 		)
 	`
 
 	if _, err := db.Exec(createTableQuery); err != nil {
-		return nil, fmt.Errorf("failed to create users table: %w", err)
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	for _, m := range migrations {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, m.Version).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %d: %w", m.Version, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", m.Version, err)
+		}
+
+		if _, err := tx.Exec(m.SQL); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.Version, m.Name, err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.Version, m.Name, time.Now())
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// SetupDatabase creates and initializes the database
+func SetupDatabase() (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", "users.db")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := RunMigrations(db, migrations); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
@@ -621,17 +3343,33 @@ func SetupDatabase() (*sql.DB, error) {
 
 // Config represents application configuration
 type Config struct {
-	Port     string
-	Database string
-	LogLevel string
+	Port         string
+	Database     string
+	LogLevel     string
+	LogFile      string
+	AccessLog    AccessLogFormat
+	MaxPageLimit int
+	JWTSecret    string
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
+	// An unrecognised ACCESS_LOG_FORMAT leaves access logging off
+	accessLog, _ := ParseAccessLogFormat(getEnv("ACCESS_LOG_FORMAT", "off"))
+
+	maxPageLimit, err := strconv.Atoi(getEnv("MAX_PAGE_LIMIT", "100"))
+	if err != nil || maxPageLimit < 1 {
+		maxPageLimit = 100
+	}
+
 	return &Config{
-		Port:     getEnv("PORT", "8080"),
-		Database: getEnv("DATABASE", "users.db"),
-		LogLevel: getEnv("LOG_LEVEL", "info"),
+		Port:         getEnv("PORT", "8080"),
+		Database:     getEnv("DATABASE", "users.db"),
+		LogLevel:     getEnv("LOG_LEVEL", "info"),
+		LogFile:      os.Getenv("LOG_FILE"),
+		AccessLog:    accessLog,
+		MaxPageLimit: maxPageLimit,
+		JWTSecret:    os.Getenv("JWT_SECRET"),
 	}
 }
 
@@ -642,6 +3380,106 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// === STARTUP ===
+
+// version is set at build time with -ldflags "-X main.version=1.2.0"
+var version = "dev"
+
+// dependencyCheckTimeout bounds each readiness check during Bootstrap
+const dependencyCheckTimeout = 5 * time.Second
+
+// sensitiveConfigWords mark config fields whose values must not be logged
+var sensitiveConfigWords = []string{"password", "secret", "token", "key"}
+
+// DependencyCheck verifies that one external dependency is ready
+type DependencyCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Bootstrap logs structured startup information and runs each dependency
+// check once, failing fast so the server never accepts traffic it can't serve
+func Bootstrap(cfg *Config, logger Logger, deps ...DependencyCheck) error {
+	fields := []interface{}{"version", version}
+	for _, kv := range redactedConfig(cfg) {
+		fields = append(fields, kv[0], kv[1])
+	}
+	logger.Info("Starting application", fields...)
+
+	listenAddr := ":" + cfg.Port
+	addr, err := net.ResolveTCPAddr("tcp", listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve listen address %q: %w", listenAddr, err)
+	}
+	logger.Info("Resolved listen address", "addr", addr.String())
+
+	for _, dep := range deps {
+		ctx, cancel := context.WithTimeout(context.Background(), dependencyCheckTimeout)
+		err := dep.Check(ctx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("dependency %s is not ready: %w", dep.Name, err)
+		}
+		logger.Info("Dependency ready", "name", dep.Name)
+	}
+
+	return nil
+}
+
+// redactedConfig returns a config struct (or pointer to one) as ordered
+// key/value pairs, masking sensitive fields and any password embedded in a
+// URL-style value
+func redactedConfig(cfg interface{}) [][2]string {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+	t := v.Type()
+
+	pairs := make([][2]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Name
+		value := fmt.Sprint(v.Field(i).Interface())
+
+		lower := strings.ToLower(name)
+		for _, word := range sensitiveConfigWords {
+			if strings.Contains(lower, word) && value != "" {
+				value = "[REDACTED]"
+				break
+			}
+		}
+
+		if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				u.User = url.UserPassword(u.User.Username(), "REDACTED")
+				value = u.String()
+			}
+		}
+
+		pairs = append(pairs, [2]string{strings.ToLower(name), value})
+	}
+	return pairs
+}
+
+// shutdownTimeout bounds how long in-flight requests get to finish
+const shutdownTimeout = 10 * time.Second
+
+// GracefulShutdown stops server from accepting connections and waits up to
+// timeout for in-flight requests. If they don't finish in time the
+// remaining connections are closed forcibly and the timeout error returned.
+func GracefulShutdown(server *http.Server, timeout time.Duration, logger Logger) error {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		server.Close()
+		logger.Error("Server shutdown forced", "seconds", time.Since(start).Seconds(), "error", err)
+		return fmt.Errorf("failed to shut down gracefully: %w", err)
+	}
+
+	logger.Info("Server shutdown completed", "seconds", time.Since(start).Seconds())
+	return nil
+}
+
 // === MAIN APPLICATION ===
 
 func main() {
@@ -649,52 +3487,109 @@ func main() {
 
 	// Load configuration
 	config := LoadConfig()
-	logger := &SimpleLogger{}
+	logLevel, err := ParseLogLevel(config.LogLevel)
+	// With LOG_FILE set, every entry also goes to that file
+	var sink Logger = NewJSONLogger(os.Stderr, logLevel)
+	var logFileErr error
+	if config.LogFile != "" {
+		logFile, err := os.OpenFile(config.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			logFileErr = err
+		} else {
+			defer logFile.Close()
+			sink = NewTeeLogger(sink, NewJSONLogger(logFile, logLevel))
+		}
+	}
+	logger := NewRateLimitedLogger(sink, 10, time.Minute)
+	if err != nil {
+		logger.Error("Invalid LOG_LEVEL, using info", "error", err)
+	}
+	if logFileErr != nil {
+		logger.Error("Failed to open LOG_FILE, logging to stderr only", "path", config.LogFile, "error", logFileErr)
+	}
+	maxPageLimit = config.MaxPageLimit
 
-	logger.Info("Starting application", "port", config.Port)
+	// Setup database - the app can't run without it
+	db := Must(SetupDatabase())
+	defer db.Close()
 
-	// Setup database
-	db, err := SetupDatabase()
-	if err != nil {
-		logger.Error("Failed to setup database", "error", err)
+	// Log startup info and make sure dependencies are up before serving
+	if err := Bootstrap(config, logger, DependencyCheck{Name: "database", Check: db.PingContext}); err != nil {
+		logger.Error("Bootstrap failed", "error", err)
 		os.Exit(1)
 	}
-	defer db.Close()
 
 	// Create repository and handler
-	userRepo := NewSQLiteUserRepository(db)
-	userHandler := NewUserHandler(userRepo, logger)
+	userRepo := NewCachedRepository(NewResilientRepository(
+		NewSQLiteUserRepository(db),
+		NewCircuitBreaker("users-db", 5, 30*time.Second),
+	))
+	// Without a configured secret, tokens only stay valid until restart
+	jwtSecret := []byte(config.JWTSecret)
+	if len(jwtSecret) == 0 {
+		logger.Info("JWT_SECRET not set, using a random signing secret")
+		jwtSecret = make([]byte, 32)
+		if _, err := rand.Read(jwtSecret); err != nil {
+			logger.Error("Failed to generate JWT secret", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	tokenTTL := 24 * time.Hour
+	tokenService := NewTokenService(jwtSecret, tokenTTL)
+	tokenStore := NewInMemoryTokenStore(tokenTTL)
+	userHandler := NewUserHandler(userRepo, NewUserService(userRepo, NewBcryptHasher(0)), tokenStore, tokenService, logger)
+	requireAuth := AuthMiddleware(tokenService, tokenStore)
+	requireJSON := RequireContentType("application/json")
+
+	// Cancelled on SIGINT/SIGTERM; stops background sweepers and the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	idempotency := NewIdempotencyStore(24 * time.Hour)
+	runEvery(ctx, time.Minute, idempotency.Sweep)
+	runEvery(ctx, time.Minute, userHandler.loginLimiter.Sweep)
+	runEvery(ctx, time.Minute, logger.Flush)
 
 	// Setup router
 	router := mux.NewRouter()
 
 	// Add middleware
+	router.Use(InFlight(inFlightRequests))
+	router.Use(RequestIDMiddleware)
+	router.Use(MetricsMiddleware(httpMetrics))
 	router.Use(LoggingMiddleware(logger))
+	router.Use(AccessLogMiddleware(config.AccessLog, os.Stdout))
 	router.Use(CORSMiddleware)
 
 	// API routes
 	api := router.PathPrefix("/api").Subrouter()
 
-	// User routes
+	// User routes. Idempotency-Key replay is limited to them: replaying
+	// auth responses would hand one caller's token to another.
 	users := api.PathPrefix("/users").Subrouter()
+	users.Use(IdempotencyMiddleware(idempotency))
+	users.Handle("", requireAuth(http.HandlerFunc(userHandler.GetUsers))).Methods("GET").Queries("include_deleted", "true")
 	users.HandleFunc("", userHandler.GetUsers).Methods("GET")
+	users.HandleFunc("/import", userHandler.ImportUsers).Methods("POST")
+	users.Handle("/batch", requireJSON(http.HandlerFunc(userHandler.BatchCreateUsers))).Methods("POST")
 	users.HandleFunc("/{id}", userHandler.GetUser).Methods("GET")
-	users.HandleFunc("", userHandler.CreateUser).Methods("POST")
-	users.HandleFunc("/{id}", userHandler.UpdateUser).Methods("PUT")
-	users.HandleFunc("/{id}", userHandler.DeleteUser).Methods("DELETE")
+	users.Handle("", requireJSON(http.HandlerFunc(userHandler.CreateUser))).Methods("POST")
+	users.Handle("/{id}", requireAuth(requireJSON(http.HandlerFunc(userHandler.UpdateUser)))).Methods("PUT")
+	users.Handle("/{id}", requireAuth(requireJSON(http.HandlerFunc(userHandler.PatchUser)))).Methods("PATCH")
+	users.Handle("/{id}", requireAuth(http.HandlerFunc(userHandler.DeleteUser))).Methods("DELETE")
+	users.Handle("/{id}/restore", requireAuth(http.HandlerFunc(userHandler.RestoreUser))).Methods("POST")
 
 	// Auth routes
 	auth := api.PathPrefix("/auth").Subrouter()
-	auth.HandleFunc("/login", userHandler.Login).Methods("POST")
+	auth.Handle("/login", requireJSON(http.HandlerFunc(userHandler.Login))).Methods("POST")
+	auth.Handle("/logout", requireAuth(http.HandlerFunc(userHandler.Logout))).Methods("POST")
 
 	// Health check
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{
-			"status":    "ok",
-			"timestamp": time.Now().Format(time.RFC3339),
-		})
-	}).Methods("GET")
+	router.HandleFunc("/health", Inject(startTimeKey, time.Now())(healthHandler)).Methods("GET")
+
+	// Metrics
+	router.HandleFunc("/metrics", MetricsHandler).Methods("GET")
 
 	// Start server
 	logger.Info("Server starting", "port", config.Port)
@@ -707,7 +3602,6 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	// Graceful shutdown handling
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			logger.Error("Server failed to start", "error", err)
@@ -718,15 +3612,34 @@ func main() {
 	logger.Info("Server started successfully")
 	logger.Info("API Documentation:")
 	logger.Info("GET    /health           - Health check")
-	logger.Info("GET    /api/users        - List all users")
+	logger.Info("GET    /metrics          - Runtime metrics")
+	logger.Info("GET    /api/users        - List users (?page=&per_page= or ?offset=&limit=)")
+	logger.Info("GET    /api/users?include_deleted=true - List users including deleted ones (requires auth)")
+	logger.Info("GET    /api/users?stream=true - Stream all users")
 	logger.Info("POST   /api/users        - Create new user")
+	logger.Info("POST   /api/users/import - Import users from CSV upload")
+	logger.Info("POST   /api/users/batch  - Create users from a JSON array, all or nothing")
 	logger.Info("GET    /api/users/{id}   - Get user by ID")
-	logger.Info("PUT    /api/users/{id}   - Update user")
-	logger.Info("DELETE /api/users/{id}   - Delete user")
+	logger.Info("PUT    /api/users/{id}   - Replace user (auth)")
+	logger.Info("PATCH  /api/users/{id}   - Update some user fields (auth)")
+	logger.Info("DELETE /api/users/{id}   - Soft-delete user (auth)")
+	logger.Info("POST   /api/users/{id}/restore - Restore a deleted user (auth)")
 	logger.Info("POST   /api/auth/login   - User login")
-
-	// Keep the server running
-	select {}
+	logger.Info("POST   /api/auth/logout  - Revoke current token (auth)")
+
+	// Serve until interrupted, then drain requests before the deferred
+	// db.Close runs
+	<-ctx.Done()
+	logger.Info("Shutdown signal received")
+	GracefulShutdown(server, shutdownTimeout, logger) // logs its own outcome
+
+	// A forced close doesn't wait for handlers, so give any still running
+	// a last chance to finish with the database
+	waitCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := inFlightRequests.Wait(waitCtx); err != nil {
+		logger.Error("Exiting with requests in flight", "error", err)
+	}
 }
 
 /*
@@ -736,6 +3649,7 @@ RUNNING THE PROJECT:
    go mod init project15
    go get github.com/gorilla/mux
    go get github.com/mattn/go-sqlite3
+   go get golang.org/x/crypto/bcrypt
 
 2. Run the server:
    go run main.go
@@ -743,8 +3657,9 @@ RUNNING THE PROJECT:
 3. Test the API:
    curl -X GET http://localhost:8080/health
    curl -X GET http://localhost:8080/api/users
-   curl -X POST http://localhost:8080/api/users -H "Content-Type: application/json" -d '{"username":"john","email":"john@example.com","password":"secret"}'
-   curl -X POST http://localhost:8080/api/auth/login -H "Content-Type: application/json" -d '{"username":"john","password":"secret"}'
+   curl -X POST http://localhost:8080/api/users -H "Content-Type: application/json" -d '{"username":"john","email":"john@example.com","password":"secret123"}'
+   curl -X POST http://localhost:8080/api/auth/login -H "Content-Type: application/json" -d '{"username":"john","password":"secret123"}'
+   curl -X POST http://localhost:8080/api/auth/logout -H "Authorization: Bearer <token>"
 
 LEARNING POINTS:
 
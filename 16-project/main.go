@@ -1,12 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -42,53 +56,332 @@ type User struct {
 	Name    string    `json:"name"`
 	Email   string    `json:"email"`
 	Created time.Time `json:"created"`
+	Profile *Profile  `json:"profile,omitempty"`
+}
+
+// Profile holds the details a user fills in after signing up
+type Profile struct {
+	Bio  string   `json:"bio,omitempty"`
+	Tags []string `json:"tags,omitempty"`
 }
 
 // Order represents an order in the system
 type Order struct {
-	ID      int       `json:"id"`
-	UserID  int       `json:"user_id"`
-	Product string    `json:"product"`
-	Amount  float64   `json:"amount"`
-	Status  string    `json:"status"`
-	Created time.Time `json:"created"`
+	ID      int         `json:"id"`
+	UserID  int         `json:"user_id"`
+	Product string      `json:"product"`
+	Amount  float64     `json:"amount"`
+	Status  OrderStatus `json:"status"`
+	Created time.Time   `json:"created"`
+}
+
+// OrderStatus represents where an order is in its lifecycle
+type OrderStatus int
+
+const (
+	OrderPending OrderStatus = iota
+	// OrderDegraded marks orders accepted while the worker pool was
+	// overloaded; the reconciler processes them once capacity returns
+	OrderDegraded
+	OrderProcessing
+	OrderCompleted
+	OrderCancelled
+)
+
+var orderStatusNames = map[OrderStatus]string{
+	OrderPending:    "pending",
+	OrderDegraded:   "queued_degraded",
+	OrderProcessing: "processing",
+	OrderCompleted:  "completed",
+	OrderCancelled:  "cancelled",
+}
+
+// orderTransitions is the legal state graph; completed and cancelled are final
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:    {OrderDegraded, OrderProcessing, OrderCancelled},
+	OrderDegraded:   {OrderPending, OrderCancelled},
+	OrderProcessing: {OrderCompleted},
+}
+
+func (s OrderStatus) String() string {
+	if name, ok := orderStatusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("OrderStatus(%d)", int(s))
+}
+
+// ParseOrderStatus converts a status name back into an OrderStatus
+func ParseOrderStatus(name string) (OrderStatus, error) {
+	for status, statusName := range orderStatusNames {
+		if statusName == name {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown order status %q", name)
+}
+
+// CanTransitionTo reports whether an order may move from s to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidTransitionError is returned when an order is asked to move to a
+// status the state graph doesn't allow from where it is
+type InvalidTransitionError struct {
+	OrderID int
+	From    OrderStatus
+	To      OrderStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("order %d: illegal status change %s -> %s", e.OrderID, e.From, e.To)
+}
+
+// OrderStatusChange is the payload of order.status_changed events
+type OrderStatusChange struct {
+	OrderID int         `json:"order_id"`
+	From    OrderStatus `json:"from"`
+	To      OrderStatus `json:"to"`
+}
+
+func (s OrderStatus) MarshalJSON() ([]byte, error) {
+	name, ok := orderStatusNames[s]
+	if !ok {
+		return nil, fmt.Errorf("unknown order status %d", int(s))
+	}
+	return json.Marshal(name)
+}
+
+func (s *OrderStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	status, err := ParseOrderStatus(name)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
 }
 
 // Notification represents a notification message
 type Notification struct {
-	ID      int       `json:"id"`
-	UserID  int       `json:"user_id"`
-	Type    string    `json:"type"` // email, sms, push
-	Message string    `json:"message"`
-	Sent    bool      `json:"sent"`
-	Created time.Time `json:"created"`
+	ID       int       `json:"id"`
+	UserID   int       `json:"user_id"`
+	Type     string    `json:"type"` // email, sms, push
+	Message  string    `json:"message"`
+	Sent     bool      `json:"sent"`
+	Attempts int       `json:"attempts"` // delivery attempts so far
+	Created  time.Time `json:"created"`
+}
+
+// DeepCopy returns a copy of v that shares no pointers, slices or maps
+// with it, so callers can't mutate the original through the result.
+// Unexported struct fields are copied shallowly.
+func DeepCopy[T any](v T) T {
+	original := reflect.ValueOf(&v).Elem()
+	result := reflect.New(original.Type()).Elem()
+	deepCopyValue(result, original)
+	return result.Interface().(T)
+}
+
+func deepCopyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		elem := reflect.New(src.Type().Elem())
+		deepCopyValue(elem.Elem(), src.Elem())
+		dst.Set(elem)
+	case reflect.Struct:
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if src.Type().Field(i).IsExported() {
+				deepCopyValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			deepCopyValue(dst.Index(i), src.Index(i))
+		}
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			deepCopyValue(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		iter := src.MapRange()
+		for iter.Next() {
+			value := reflect.New(src.Type().Elem()).Elem()
+			deepCopyValue(value, iter.Value())
+			dst.SetMapIndex(iter.Key(), value)
+		}
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		value := reflect.New(src.Elem().Type()).Elem()
+		deepCopyValue(value, src.Elem())
+		dst.Set(value)
+	default:
+		dst.Set(src)
+	}
 }
 
 // === MESSAGING SYSTEM ===
 
 // Message represents a message in the system
 type Message struct {
-	ID      string      `json:"id"`
-	Topic   string      `json:"topic"`
-	Payload interface{} `json:"payload"`
-	Created time.Time   `json:"created"`
+	ID      string          `json:"id"`
+	Topic   string          `json:"topic"`
+	Payload interface{}     `json:"payload,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"` // set instead of Payload in serialize mode
+	Created time.Time       `json:"created"`
+}
+
+// As type-asserts v to T, returning the zero value and false on mismatch
+func As[T any](v any) (T, bool) {
+	result, ok := v.(T)
+	return result, ok
+}
+
+// MustAs type-asserts v to T and panics on mismatch
+func MustAs[T any](v any) T {
+	result, ok := As[T](v)
+	if !ok {
+		panic(fmt.Sprintf("value of type %T is not a %T", v, result))
+	}
+	return result
+}
+
+// DecodePayload returns the message payload as a T. In serialize mode it
+// decodes a fresh copy from Data; otherwise it type-asserts Payload.
+func DecodePayload[T any](msg Message) (T, error) {
+	var result T
+
+	if msg.Data != nil {
+		// Untyped targets keep integer IDs as int64 rather than float64
+		switch any(&result).(type) {
+		case *map[string]interface{}, *interface{}:
+			decoded, err := DecodeJSONNumbers(msg.Data)
+			if err != nil {
+				return result, fmt.Errorf("failed to decode payload for topic %s: %w", msg.Topic, err)
+			}
+			if typed, ok := As[T](decoded); ok {
+				return typed, nil
+			}
+			return result, fmt.Errorf("unexpected payload type %T for topic %s", decoded, msg.Topic)
+		}
+
+		if err := json.Unmarshal(msg.Data, &result); err != nil {
+			return result, fmt.Errorf("failed to decode payload for topic %s: %w", msg.Topic, err)
+		}
+		return result, nil
+	}
+
+	result, ok := As[T](msg.Payload)
+	if !ok {
+		return result, fmt.Errorf("unexpected payload type %T for topic %s", msg.Payload, msg.Topic)
+	}
+	return result, nil
+}
+
+// DecodeJSONNumbers decodes data like json.Unmarshal into an interface{},
+// except that whole numbers come back as int64 instead of float64
+func DecodeJSONNumbers(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return promoteNumbers(v), nil
+}
+
+// promoteNumbers replaces every json.Number in v with an int64 when it is
+// whole and fits, or a float64 otherwise
+func promoteNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			return i
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for k, elem := range value {
+			value[k] = promoteNumbers(elem)
+		}
+	case []interface{}:
+		for i, elem := range value {
+			value[i] = promoteNumbers(elem)
+		}
+	}
+	return v
 }
 
 // MessageBroker handles message publishing and subscribing
 type MessageBroker struct {
 	subscribers map[string][]chan Message
 	mu          sync.RWMutex
+	serialize   bool
+
+	dropped   map[string]int64 // messages per topic not delivered to a full subscriber
+	droppedMu sync.Mutex
 }
 
 // NewMessageBroker creates a new message broker
 func NewMessageBroker() *MessageBroker {
 	return &MessageBroker{
 		subscribers: make(map[string][]chan Message),
+		dropped:     make(map[string]int64),
 	}
 }
 
-// Subscribe adds a subscriber to a topic
-func (mb *MessageBroker) Subscribe(topic string, ch chan Message) {
+// SetSerializePayloads enables JSON-encoding payloads at publish time, so
+// subscribers get their own copy and publishers may keep mutating theirs
+func (mb *MessageBroker) SetSerializePayloads(enabled bool) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.serialize = enabled
+}
+
+// Subscription is the handle Subscribe returns for one channel on one topic
+type Subscription struct {
+	broker *MessageBroker
+	topic  string
+	ch     chan Message
+	once   sync.Once
+}
+
+// Unsubscribe stops delivery to the subscription's channel. It is safe to
+// call more than once.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.broker.Unsubscribe(s.topic, s.ch)
+	})
+}
+
+// Subscribe adds a subscriber to a topic. The broker keeps sending to ch
+// until it is unsubscribed, so callers should Unsubscribe before closing
+// ch; a channel closed while still subscribed is dropped by the next
+// Publish to the topic.
+func (mb *MessageBroker) Subscribe(topic string, ch chan Message) *Subscription {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
 
@@ -97,10 +390,37 @@ func (mb *MessageBroker) Subscribe(topic string, ch chan Message) {
 	}
 
 	mb.subscribers[topic] = append(mb.subscribers[topic], ch)
+	return &Subscription{broker: mb, topic: topic, ch: ch}
+}
+
+// Unsubscribe removes ch from a topic; removing a channel that isn't
+// subscribed does nothing. Once it returns, Publish will no longer send to
+// ch, so ch may then be closed.
+func (mb *MessageBroker) Unsubscribe(topic string, ch chan Message) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	subscribers := mb.subscribers[topic]
+	for i, sub := range subscribers {
+		if sub == ch {
+			mb.subscribers[topic] = append(subscribers[:i:i], subscribers[i+1:]...)
+			return
+		}
+	}
 }
 
-// Publish sends a message to all subscribers of a topic
+// Publish sends a message to all subscribers of a topic. It never waits:
+// a subscriber whose buffer is full misses the message, which is counted
+// in DroppedCount.
 func (mb *MessageBroker) Publish(topic string, payload interface{}) {
+	for _, ch := range mb.publish(topic, payload) {
+		mb.Unsubscribe(topic, ch)
+	}
+}
+
+// publish delivers to every subscriber under the read lock and returns the
+// channels it found closed, which Publish removes once the lock is released
+func (mb *MessageBroker) publish(topic string, payload interface{}) []chan Message {
 	mb.mu.RLock()
 	defer mb.mu.RUnlock()
 
@@ -111,17 +431,181 @@ func (mb *MessageBroker) Publish(topic string, payload interface{}) {
 		Created: time.Now(),
 	}
 
-	if subscribers, exists := mb.subscribers[topic]; exists {
-		for _, ch := range subscribers {
+	if mb.serialize {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			log.Printf("Failed to serialize payload for topic %s: %v", topic, err)
+			return nil
+		}
+		message.Payload = nil
+		message.Data = data
+	}
+
+	var closed []chan Message
+	for _, ch := range mb.subscribers[topic] {
+		sent, isClosed := deliver(ch, message)
+		switch {
+		case isClosed:
+			closed = append(closed, ch)
+		case !sent:
+			mb.droppedMu.Lock()
+			mb.dropped[topic]++
+			mb.droppedMu.Unlock()
+		}
+	}
+	return closed
+}
+
+// DroppedCount returns how many messages on topic were dropped because a
+// subscriber wasn't ready to receive them
+func (mb *MessageBroker) DroppedCount(topic string) int64 {
+	mb.droppedMu.Lock()
+	defer mb.droppedMu.Unlock()
+	return mb.dropped[topic]
+}
+
+// deliver sends message to ch if it has room, without blocking. A channel
+// its consumer closed without unsubscribing is reported as closed instead
+// of panicking the publisher.
+func deliver(ch chan Message, message Message) (sent, closed bool) {
+	defer func() {
+		if recover() != nil {
+			sent, closed = false, true
+		}
+	}()
+
+	select {
+	case ch <- message:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// TypedBroker publishes and subscribes to a single topic carrying T,
+// hiding the raw Message channels behind typed ones
+type TypedBroker[T any] struct {
+	broker *MessageBroker
+	topic  string
+}
+
+// NewTypedBroker creates a typed view of topic on broker
+func NewTypedBroker[T any](broker *MessageBroker, topic string) *TypedBroker[T] {
+	return &TypedBroker[T]{broker: broker, topic: topic}
+}
+
+// Publish sends value to every subscriber of the topic
+func (tb *TypedBroker[T]) Publish(value T) {
+	tb.broker.Publish(tb.topic, value)
+}
+
+// Subscribe returns a channel of decoded values and a cancel func that
+// unsubscribes and closes the channel. Messages that don't decode as T are
+// logged and skipped.
+func (tb *TypedBroker[T]) Subscribe() (<-chan T, func()) {
+	raw := make(chan Message, 100)
+	out := make(chan T)
+	done := make(chan struct{})
+
+	sub := tb.broker.Subscribe(tb.topic, raw)
+
+	go func() {
+		defer close(out)
+		for {
 			select {
-			case ch <- message:
-			case <-time.After(100 * time.Millisecond):
-				log.Printf("Failed to send message to subscriber for topic %s", topic)
+			case msg := <-raw:
+				value, err := DecodePayload[T](msg)
+				if err != nil {
+					log.Printf("Dropping message on %s: %v", tb.topic, err)
+					continue
+				}
+				select {
+				case out <- value:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
 			}
 		}
+	}()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			sub.Unsubscribe()
+			close(done)
+		})
+	}
+	return out, cancel
+}
+
+// === OBSERVABLE VALUES ===
+
+// Observable holds a value and notifies watchers whenever it changes.
+// Slow watchers never block Set: they just see the latest value.
+type Observable[T any] struct {
+	value    T
+	watchers map[int]chan T
+	nextID   int
+	mu       sync.RWMutex
+}
+
+// NewObservable creates an observable holding initial
+func NewObservable[T any](initial T) *Observable[T] {
+	return &Observable[T]{
+		value:    initial,
+		watchers: make(map[int]chan T),
+	}
+}
+
+// Get returns the current value
+func (o *Observable[T]) Get() T {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.value
+}
+
+// Set stores value and delivers it to every watcher, replacing any update
+// a watcher hasn't read yet
+func (o *Observable[T]) Set(value T) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.value = value
+	for _, ch := range o.watchers {
+		select {
+		case <-ch: // drop the stale, unread value
+		default:
+		}
+		ch <- value
 	}
 }
 
+// Watch returns a channel primed with the current value that then receives
+// each change, and a cancel func that unsubscribes and closes the channel
+func (o *Observable[T]) Watch() (<-chan T, func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	id := o.nextID
+	o.nextID++
+	ch := make(chan T, 1)
+	ch <- o.value
+	o.watchers[id] = ch
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			o.mu.Lock()
+			defer o.mu.Unlock()
+			delete(o.watchers, id)
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
 // === CIRCUIT BREAKER ===
 
 // CircuitBreakerState represents the state of a circuit breaker
@@ -133,57 +617,176 @@ const (
 	HalfOpen
 )
 
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitBreakerState(%d)", int(s))
+	}
+}
+
+// ErrCircuitOpen is returned (wrapped) while a breaker rejects calls
+var ErrCircuitOpen = errors.New("open")
+
+// errCallPanicked is recorded as the result of a call whose fn panicked
+var errCallPanicked = errors.New("call panicked")
+
 // CircuitBreaker implements the circuit breaker pattern
 type CircuitBreaker struct {
-	name            string
-	maxFailures     int
-	timeout         time.Duration
-	failures        int
-	lastFailureTime time.Time
-	state           CircuitBreakerState
-	mutex           sync.RWMutex
+	name             string
+	maxFailures      int
+	successThreshold int
+	timeout          time.Duration
+	failures         int
+	successes        int // consecutive successful probes while half-open
+	lastFailureTime  time.Time
+	state            CircuitBreakerState
+	probing          bool // a half-open probe is in flight
+	observedState    *Observable[CircuitBreakerState]
+	mutex            sync.RWMutex
+
+	// OnStateChange, if set, is called after every actual state change,
+	// outside the breaker's lock so it may call back into the breaker
+	OnStateChange func(name string, from, to CircuitBreakerState)
 }
 
-// NewCircuitBreaker creates a new circuit breaker
-func NewCircuitBreaker(name string, maxFailures int, timeout time.Duration) *CircuitBreaker {
+// NewCircuitBreaker creates a circuit breaker that opens after maxFailures
+// consecutive failures and, once half-open, needs successThreshold
+// consecutive successful probes to close again
+func NewCircuitBreaker(name string, maxFailures, successThreshold int, timeout time.Duration) *CircuitBreaker {
+	if successThreshold < 1 {
+		successThreshold = 1
+	}
 	return &CircuitBreaker{
-		name:        name,
-		maxFailures: maxFailures,
-		timeout:     timeout,
-		state:       Closed,
+		name:             name,
+		maxFailures:      maxFailures,
+		successThreshold: successThreshold,
+		timeout:          timeout,
+		state:            Closed,
+		observedState:    NewObservable(Closed),
+	}
+}
+
+// WithStateChangeHook sets OnStateChange and returns cb for chaining
+func (cb *CircuitBreaker) WithStateChangeHook(hook func(name string, from, to CircuitBreakerState)) *CircuitBreaker {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.OnStateChange = hook
+	return cb
+}
+
+// setState changes the state and notifies watchers. Callers must hold
+// cb.mutex, and call the returned func once they have released it to run
+// OnStateChange.
+func (cb *CircuitBreaker) setState(state CircuitBreakerState) func() {
+	if cb.state == state {
+		return func() {}
+	}
+	from := cb.state
+	cb.state = state
+	cb.observedState.Set(state)
+
+	hook := cb.OnStateChange
+	if hook == nil {
+		return func() {}
+	}
+	return func() { hook(cb.name, from, state) }
+}
+
+// WatchState streams the breaker's state as it changes; call the returned
+// func to stop watching
+func (cb *CircuitBreaker) WatchState() (<-chan CircuitBreakerState, func()) {
+	return cb.observedState.Watch()
+}
+
+// Execute executes a function with circuit breaker protection. fn runs
+// without the breaker's lock held, so slow calls don't queue up behind
+// each other. A panic in fn counts as a failure and is re-raised.
+func (cb *CircuitBreaker) Execute(fn func() error) (err error) {
+	probe, notify, err := cb.allow()
+	notify()
+	if err != nil {
+		return err
 	}
+
+	// Record from a defer so a panicking fn still releases the probe slot
+	panicked := true
+	defer func() {
+		if panicked {
+			err = errCallPanicked
+		}
+		cb.record(probe, err)()
+	}()
+
+	err = fn()
+	panicked = false
+	return err
 }
 
-// Execute executes a function with circuit breaker protection
-func (cb *CircuitBreaker) Execute(fn func() error) error {
+// allow decides whether a call may run. Once the timeout has passed an
+// open breaker goes half-open, and only one call at a time is let through
+// as a probe; everyone else is rejected until the probe's result is in.
+func (cb *CircuitBreaker) allow() (probe bool, notify func(), err error) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
+	notify = func() {}
 	if cb.state == Open {
-		if time.Since(cb.lastFailureTime) > cb.timeout {
-			cb.state = HalfOpen
-			cb.failures = 0
-		} else {
-			return fmt.Errorf("circuit breaker %s is open", cb.name)
+		if time.Since(cb.lastFailureTime) <= cb.timeout {
+			return false, notify, fmt.Errorf("circuit breaker %s is %w", cb.name, ErrCircuitOpen)
+		}
+		notify = cb.setState(HalfOpen)
+		cb.failures = 0
+		cb.successes = 0
+	}
+
+	if cb.state == HalfOpen {
+		if cb.probing {
+			return false, notify, fmt.Errorf("circuit breaker %s is %w", cb.name, ErrCircuitOpen)
 		}
+		cb.probing = true
+		return true, notify, nil
+	}
+
+	return false, notify, nil
+}
+
+// record updates the breaker with a call's outcome. A failed probe reopens
+// the breaker straight away, and successThreshold successful ones in a row
+// close it; other calls open it after maxFailures consecutive failures.
+func (cb *CircuitBreaker) record(probe bool, err error) func() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if probe {
+		cb.probing = false
 	}
 
-	err := fn()
 	if err != nil {
 		cb.failures++
 		cb.lastFailureTime = time.Now()
 
-		if cb.failures >= cb.maxFailures {
-			cb.state = Open
+		if probe || cb.failures >= cb.maxFailures {
+			cb.successes = 0
+			return cb.setState(Open)
 		}
-
-		return err
+		return func() {}
 	}
 
 	// Success
 	cb.failures = 0
-	cb.state = Closed
-	return nil
+	if probe {
+		cb.successes++
+		if cb.successes >= cb.successThreshold {
+			return cb.setState(Closed)
+		}
+	}
+	return func() {}
 }
 
 // GetState returns the current state of the circuit breaker
@@ -193,6 +796,61 @@ func (cb *CircuitBreaker) GetState() CircuitBreakerState {
 	return cb.state
 }
 
+// Trip forces the breaker open, e.g. to pre-empt a downstream known to be failing
+func (cb *CircuitBreaker) Trip() {
+	cb.mutex.Lock()
+	notify := cb.setState(Open)
+	cb.lastFailureTime = time.Now()
+	cb.mutex.Unlock()
+	notify()
+}
+
+// Reset forces the breaker closed and clears the failure count
+func (cb *CircuitBreaker) Reset() {
+	cb.mutex.Lock()
+	notify := cb.setState(Closed)
+	cb.failures = 0
+	cb.mutex.Unlock()
+	notify()
+}
+
+// Failures returns the current consecutive failure count
+func (cb *CircuitBreaker) Failures() int {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.failures
+}
+
+// BreakerRegistry looks up circuit breakers by name for admin operations
+type BreakerRegistry struct {
+	breakers map[string]*CircuitBreaker
+	mu       sync.RWMutex
+}
+
+// NewBreakerRegistry creates a registry holding the given breakers
+func NewBreakerRegistry(breakers ...*CircuitBreaker) *BreakerRegistry {
+	br := &BreakerRegistry{breakers: make(map[string]*CircuitBreaker)}
+	for _, cb := range breakers {
+		br.Register(cb)
+	}
+	return br
+}
+
+// Register adds cb under its name, replacing any breaker with the same name
+func (br *BreakerRegistry) Register(cb *CircuitBreaker) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.breakers[cb.name] = cb
+}
+
+// Get returns the breaker registered under name
+func (br *BreakerRegistry) Get(name string) (*CircuitBreaker, bool) {
+	br.mu.RLock()
+	defer br.mu.RUnlock()
+	cb, ok := br.breakers[name]
+	return cb, ok
+}
+
 // === WORKER POOL ===
 
 // WorkerPool manages a pool of workers
@@ -201,14 +859,60 @@ type WorkerPool struct {
 	jobQueue   chan Job
 	workerPool chan chan Job
 	quit       chan bool
+	stopOnce   sync.Once
 	wg         sync.WaitGroup
+	stats      map[string]*jobTypeStats
+	statsMu    sync.Mutex
+	active     atomic.Int64 // jobs whose Task is running right now
 }
 
+// ErrJobExpired is sent on a job's Result channel when its deadline passed
+// before a worker could pick it up
+var ErrJobExpired = errors.New("job deadline exceeded before execution")
+
 // Job represents a unit of work
 type Job struct {
-	ID     string
-	Task   func() error
-	Result chan error
+	ID       string
+	Type     string    // optional label used to group stats, e.g. "order"
+	Deadline time.Time // optional; zero means the job never expires
+	Task     func() error
+	Result   chan error
+
+	// MaxRetries is how many more times a failing Task is run before its
+	// error is reported. Retries wait Backoff, then twice that, and so on.
+	MaxRetries int
+	Backoff    time.Duration
+	attempt    int
+
+	ctx context.Context // set by SubmitWithContext
+}
+
+// expired reports whether the job's deadline has passed
+func (j Job) expired() bool {
+	return !j.Deadline.IsZero() && time.Now().After(j.Deadline)
+}
+
+// JobStats summarizes executed jobs of a single type
+type JobStats struct {
+	Count           int64         `json:"count"`
+	Successes       int64         `json:"successes"`
+	Failures        int64         `json:"failures"`
+	AverageDuration time.Duration `json:"average_duration"`
+}
+
+// PoolStats is a point-in-time view of how busy a pool is
+type PoolStats struct {
+	Queued  int   `json:"queued"`
+	Workers int   `json:"workers"`
+	Active  int64 `json:"active"`
+}
+
+// jobTypeStats accumulates raw totals for one job type
+type jobTypeStats struct {
+	count         int64
+	successes     int64
+	failures      int64
+	totalDuration time.Duration
 }
 
 // NewWorkerPool creates a new worker pool
@@ -218,6 +922,7 @@ func NewWorkerPool(workers int, queueSize int) *WorkerPool {
 		jobQueue:   make(chan Job, queueSize),
 		workerPool: make(chan chan Job, workers),
 		quit:       make(chan bool),
+		stats:      make(map[string]*jobTypeStats),
 	}
 }
 
@@ -245,8 +950,22 @@ func (wp *WorkerPool) worker(id int) {
 
 		select {
 		case job := <-jobChannel:
-			// Execute job
-			err := job.Task()
+			var err error
+			if job.ctx != nil && job.ctx.Err() != nil {
+				// The submitter gave up while the job was queued
+				err = job.ctx.Err()
+			} else {
+				// Execute job
+				start := time.Now()
+				wp.active.Add(1)
+				err = job.Task()
+				wp.active.Add(-1)
+				wp.recordStats(job.Type, time.Since(start), err)
+				if err != nil && job.attempt < job.MaxRetries {
+					wp.retry(job, err)
+					continue
+				}
+			}
 			select {
 			case job.Result <- err:
 			case <-time.After(1 * time.Second):
@@ -265,6 +984,16 @@ func (wp *WorkerPool) dispatch() {
 	for {
 		select {
 		case job := <-wp.jobQueue:
+			// Skip stale work instead of running it late
+			if job.expired() {
+				select {
+				case job.Result <- ErrJobExpired:
+				default:
+					log.Printf("Dispatcher: job %s expired, no result receiver", job.ID)
+				}
+				continue
+			}
+
 			// Get available worker
 			select {
 			case jobChannel := <-wp.workerPool:
@@ -284,58 +1013,554 @@ func (wp *WorkerPool) Submit(job Job) {
 	wp.jobQueue <- job
 }
 
-// Stop stops the worker pool
-func (wp *WorkerPool) Stop() {
-	close(wp.quit)
-	wp.wg.Wait()
-}
-
-// === SERVICES ===
-
-// UserService handles user-related operations
-type UserService struct {
-	users   map[int]*User
-	mu      sync.RWMutex
-	broker  *MessageBroker
-	breaker *CircuitBreaker
-}
+// SubmitWithContext queues job unless ctx is done first, in which case it
+// returns ctx.Err(). If ctx is cancelled after the job is queued, the job
+// is skipped and ctx.Err() is sent as its result.
+func (wp *WorkerPool) SubmitWithContext(ctx context.Context, job Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-// NewUserService creates a new user service
-func NewUserService(broker *MessageBroker) *UserService {
-	return &UserService{
-		users:   make(map[int]*User),
-		broker:  broker,
-		breaker: NewCircuitBreaker("user-service", 3, 30*time.Second),
+	job.ctx = ctx
+	select {
+	case wp.jobQueue <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-// CreateUser creates a new user
-func (us *UserService) CreateUser(name, email string) (*User, error) {
-	var user *User
-	var err error
-
-	err = us.breaker.Execute(func() error {
-		us.mu.Lock()
-		defer us.mu.Unlock()
+// retry puts a failed job back on the queue once its backoff has passed.
+// The wait happens on a timer, so the worker is free for other jobs. If
+// the pool stops first, err is reported as the job's result.
+func (wp *WorkerPool) retry(job Job, err error) {
+	delay := job.Backoff << job.attempt
+	job.attempt++
 
-		// Simulate potential failure
-		if rand.Float64() < 0.1 {
-			return fmt.Errorf("random failure in user creation")
+	abandon := func() {
+		select {
+		case job.Result <- err:
+		default:
+			log.Printf("Pool stopped before retrying job %s, no result receiver", job.ID)
+		}
+	}
+
+	time.AfterFunc(delay, func() {
+		// Check quit on its own first: a buffered queue with room would
+		// otherwise accept the job even though nothing dispatches it anymore
+		select {
+		case <-wp.quit:
+			abandon()
+			return
+		default:
+		}
+
+		select {
+		case wp.jobQueue <- job:
+		case <-wp.quit:
+			abandon()
+		}
+	})
+}
+
+// recordStats adds one job execution to the per-type totals
+func (wp *WorkerPool) recordStats(jobType string, duration time.Duration, err error) {
+	if jobType == "" {
+		jobType = "untyped"
+	}
+
+	wp.statsMu.Lock()
+	defer wp.statsMu.Unlock()
+
+	stats, exists := wp.stats[jobType]
+	if !exists {
+		stats = &jobTypeStats{}
+		wp.stats[jobType] = stats
+	}
+
+	stats.count++
+	stats.totalDuration += duration
+	if err != nil {
+		stats.failures++
+	} else {
+		stats.successes++
+	}
+}
+
+// StatsByType returns a snapshot of execution stats grouped by job type
+func (wp *WorkerPool) StatsByType() map[string]JobStats {
+	wp.statsMu.Lock()
+	defer wp.statsMu.Unlock()
+
+	result := make(map[string]JobStats, len(wp.stats))
+	for jobType, stats := range wp.stats {
+		result[jobType] = JobStats{
+			Count:           stats.count,
+			Successes:       stats.successes,
+			Failures:        stats.failures,
+			AverageDuration: stats.totalDuration / time.Duration(stats.count),
+		}
+	}
+
+	return result
+}
+
+// Stats reports how many jobs are waiting, how many workers there are and
+// how many of them are running a job
+func (wp *WorkerPool) Stats() PoolStats {
+	return PoolStats{
+		Queued:  len(wp.jobQueue),
+		Workers: wp.workers,
+		Active:  wp.active.Load(),
+	}
+}
+
+// Overloaded reports whether the job queue is nearly full (80% or more),
+// signalling callers to shed or defer work instead of blocking on Submit
+func (wp *WorkerPool) Overloaded() bool {
+	return len(wp.jobQueue)*5 >= cap(wp.jobQueue)*4
+}
+
+// Stop stops the worker pool, waiting for running jobs to finish
+func (wp *WorkerPool) Stop() {
+	wp.stopOnce.Do(func() { close(wp.quit) })
+	wp.wg.Wait()
+}
+
+// StopWithTimeout stops the worker pool but waits at most d for running
+// jobs. On timeout it returns ErrShutdownTimeout and leaves the stuck
+// workers behind so the rest of shutdown can proceed.
+func (wp *WorkerPool) StopWithTimeout(d time.Duration) error {
+	wp.stopOnce.Do(func() { close(wp.quit) })
+
+	done := make(chan struct{})
+	go func() {
+		wp.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(d):
+		return fmt.Errorf("%w: workers still busy after %v", ErrShutdownTimeout, d)
+	}
+}
+
+// === LIFECYCLE ===
+
+// ErrShutdownTimeout is returned when supervised goroutines outlive Shutdown
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
+// Supervisor tracks background goroutines so they can be cancelled and
+// waited for together instead of leaking when a service stops
+type Supervisor struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	nextID  int
+	running map[int]string // goroutine id -> file:line it was started from
+	stopped bool
+}
+
+// NewSupervisor creates a new supervisor
+func NewSupervisor() *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Supervisor{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[int]string),
+	}
+}
+
+// Go runs fn in a tracked goroutine. fn must return once ctx is cancelled.
+// Calls after Shutdown are ignored.
+func (s *Supervisor) Go(fn func(ctx context.Context)) {
+	_, file, line, _ := runtime.Caller(1)
+	site := fmt.Sprintf("%s:%d", filepath.Base(file), line)
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	id := s.nextID
+	s.nextID++
+	s.running[id] = site
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, id)
+			s.mu.Unlock()
+			s.wg.Done()
+		}()
+		fn(s.ctx)
+	}()
+}
+
+// Shutdown cancels all goroutines and waits up to timeout for them to exit.
+// It returns ErrShutdownTimeout listing where the stragglers were started.
+func (s *Supervisor) Shutdown(timeout time.Duration) error {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	s.mu.Lock()
+	sites := make([]string, 0, len(s.running))
+	for _, site := range s.running {
+		sites = append(sites, site)
+	}
+	s.mu.Unlock()
+	sort.Strings(sites)
+
+	return fmt.Errorf("%w: %d goroutine(s) still running, started at %s",
+		ErrShutdownTimeout, len(sites), strings.Join(sites, ", "))
+}
+
+// Semaphore bounds how many callers may hold a slot at once
+type Semaphore struct {
+	slots chan struct{}
+}
+
+// NewSemaphore creates a semaphore with n slots
+func NewSemaphore(n int) *Semaphore {
+	if n < 1 {
+		n = 1
+	}
+	return &Semaphore{slots: make(chan struct{}, n)}
+}
+
+// Acquire blocks until a slot is free or ctx is done
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes a slot only if one is free right now
+func (s *Semaphore) TryAcquire() bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release frees a slot taken by Acquire or TryAcquire
+func (s *Semaphore) Release() {
+	select {
+	case <-s.slots:
+	default:
+		panic("semaphore: release without acquire")
+	}
+}
+
+// === ERROR METRICS ===
+
+var (
+	// ErrNotFound is wrapped by lookups for missing entities
+	ErrNotFound = errors.New("not found")
+	// ErrSimulatedFailure is wrapped by the services' injected random failures
+	ErrSimulatedFailure = errors.New("simulated failure")
+	// ErrReadOnly is returned by writes while a service is in read-only mode
+	ErrReadOnly = errors.New("service is in read-only mode")
+)
+
+// ErrorCategory buckets an error for metrics
+func ErrorCategory(err error) string {
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrSimulatedFailure):
+		return "simulated"
+	case errors.Is(err, ErrReadOnly):
+		return "read_only"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "internal"
+	}
+}
+
+// WindowCounter counts events over a sliding time window. Timestamps live
+// in a ring buffer that grows when full; entries older than maxAge are
+// pruned as new ones arrive.
+type WindowCounter struct {
+	events []time.Time
+	head   int
+	count  int
+	maxAge time.Duration
+	now    func() time.Time // injectable clock for tests
+	mu     sync.Mutex
+}
+
+// NewWindowCounter creates a counter that can answer CountLast for any
+// duration up to maxAge
+func NewWindowCounter(maxAge time.Duration) *WindowCounter {
+	return &WindowCounter{
+		events: make([]time.Time, 16),
+		maxAge: maxAge,
+		now:    time.Now,
+	}
+}
+
+// Record adds one event at the current time
+func (wc *WindowCounter) Record() {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	now := wc.now()
+	wc.prune(now)
+
+	if wc.count == len(wc.events) {
+		grown := make([]time.Time, 2*len(wc.events))
+		for i := 0; i < wc.count; i++ {
+			grown[i] = wc.events[(wc.head+i)%len(wc.events)]
+		}
+		wc.events = grown
+		wc.head = 0
+	}
+
+	wc.events[(wc.head+wc.count)%len(wc.events)] = now
+	wc.count++
+}
+
+// CountLast returns how many events were recorded within the last d
+func (wc *WindowCounter) CountLast(d time.Duration) int {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	now := wc.now()
+	wc.prune(now)
+
+	// Events are in time order, so count back from the newest
+	cutoff := now.Add(-d)
+	n := 0
+	for i := wc.count - 1; i >= 0; i-- {
+		if !wc.events[(wc.head+i)%len(wc.events)].After(cutoff) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// prune drops events older than maxAge. Callers must hold wc.mu.
+func (wc *WindowCounter) prune(now time.Time) {
+	cutoff := now.Add(-wc.maxAge)
+	for wc.count > 0 && !wc.events[wc.head].After(cutoff) {
+		wc.head = (wc.head + 1) % len(wc.events)
+		wc.count--
+	}
+}
+
+// ErrorCounter tallies errors by operation name and category
+type ErrorCounter struct {
+	counts map[string]map[string]int64
+	recent *WindowCounter
+	mu     sync.Mutex
+}
+
+// NewErrorCounter creates an empty error counter
+func NewErrorCounter() *ErrorCounter {
+	return &ErrorCounter{
+		counts: make(map[string]map[string]int64),
+		recent: NewWindowCounter(time.Minute),
+	}
+}
+
+// Record counts err against operation; nil errors are ignored
+func (ec *ErrorCounter) Record(operation string, err error) {
+	if err == nil {
+		return
+	}
+
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	byCategory, exists := ec.counts[operation]
+	if !exists {
+		byCategory = make(map[string]int64)
+		ec.counts[operation] = byCategory
+	}
+	byCategory[ErrorCategory(err)]++
+	ec.recent.Record()
+}
+
+// RecentCount returns how many errors were recorded within the last d,
+// up to one minute
+func (ec *ErrorCounter) RecentCount(d time.Duration) int {
+	return ec.recent.CountLast(d)
+}
+
+// Count returns how many errors of category operation has recorded
+func (ec *ErrorCounter) Count(operation, category string) int64 {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	return ec.counts[operation][category]
+}
+
+// Snapshot returns a copy of all counts as operation -> category -> count
+func (ec *ErrorCounter) Snapshot() map[string]map[string]int64 {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	snapshot := make(map[string]map[string]int64, len(ec.counts))
+	for operation, byCategory := range ec.counts {
+		snapshot[operation] = make(map[string]int64, len(byCategory))
+		for category, count := range byCategory {
+			snapshot[operation][category] = count
+		}
+	}
+	return snapshot
+}
+
+// === SERVICES ===
+
+// RandSource is the randomness the services use to simulate failures.
+// Inject a seeded source in tests to get a reproducible sequence.
+type RandSource interface {
+	Intn(n int) int
+	Float64() float64
+}
+
+// globalRand uses math/rand's shared, concurrency-safe source
+type globalRand struct{}
+
+func (globalRand) Intn(n int) int   { return rand.Intn(n) }
+func (globalRand) Float64() float64 { return rand.Float64() }
+
+// lockedRand makes a *rand.Rand safe to share between goroutines
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// NewSeededRand returns a deterministic RandSource for the given seed
+func NewSeededRand(seed int64) RandSource {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Intn(n)
+}
+
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+// UserService handles user-related operations
+type UserService struct {
+	users       map[int]*User
+	mu          sync.RWMutex
+	broker      *MessageBroker
+	breaker     *CircuitBreaker
+	rand        RandSource
+	failureRate float64 // share of CreateUser calls that fail on purpose
+	errs        *ErrorCounter
+	readOnly    atomic.Bool
+}
+
+// defaultUserFailureRate is the share of user creations that fail to
+// exercise the circuit breaker
+const defaultUserFailureRate = 0.1
+
+// NewUserService creates a new user service
+func NewUserService(broker *MessageBroker) *UserService {
+	return &UserService{
+		users:       make(map[int]*User),
+		broker:      broker,
+		breaker:     NewCircuitBreaker("user-service", 3, 2, 30*time.Second),
+		rand:        globalRand{},
+		failureRate: defaultUserFailureRate,
+		errs:        NewErrorCounter(),
+	}
+}
+
+// SetRandSource replaces the source used to simulate failures.
+// Call it before the service starts handling requests.
+func (us *UserService) SetRandSource(r RandSource) {
+	us.rand = r
+}
+
+// SetFailureRate sets the share of CreateUser calls, from 0 to 1, that
+// fail on purpose; 0 disables failures and 1 makes every call fail
+func (us *UserService) SetFailureRate(rate float64) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.failureRate = rate
+}
+
+// SetReadOnly toggles maintenance mode: writes fail with ErrReadOnly
+// while reads keep working
+func (us *UserService) SetReadOnly(readOnly bool) {
+	us.readOnly.Store(readOnly)
+}
+
+// CreateUser creates a new user
+func (us *UserService) CreateUser(name, email string) (*User, error) {
+	if us.readOnly.Load() {
+		us.errs.Record("CreateUser", ErrReadOnly)
+		return nil, ErrReadOnly
+	}
+
+	var user *User
+	var err error
+
+	err = us.breaker.Execute(func() error {
+		us.mu.Lock()
+		defer us.mu.Unlock()
+
+		// Simulate potential failure
+		if us.rand.Float64() < us.failureRate {
+			return fmt.Errorf("%w in user creation", ErrSimulatedFailure)
 		}
 
 		id := len(us.users) + 1
-		user = &User{
+		stored := &User{
 			ID:      id,
 			Name:    name,
 			Email:   email,
 			Created: time.Now(),
+			Profile: &Profile{},
 		}
 
-		us.users[id] = user
+		us.users[id] = stored
+		user = DeepCopy(stored)
 		return nil
 	})
 
 	if err != nil {
+		us.errs.Record("CreateUser", err)
 		return nil, err
 	}
 
@@ -352,10 +1577,26 @@ func (us *UserService) GetUser(id int) (*User, error) {
 
 	user, exists := us.users[id]
 	if !exists {
-		return nil, fmt.Errorf("user not found")
+		err := fmt.Errorf("user %w", ErrNotFound)
+		us.errs.Record("GetUser", err)
+		return nil, err
 	}
 
-	return user, nil
+	// Hand out a copy so callers can't mutate the stored user
+	return DeepCopy(user), nil
+}
+
+// GetAll returns copies of every user, ordered by ID
+func (us *UserService) GetAll() []*User {
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+
+	users := make([]*User, 0, len(us.users))
+	for _, user := range us.users {
+		users = append(users, DeepCopy(user))
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
 }
 
 // OrderService handles order-related operations
@@ -365,6 +1606,22 @@ type OrderService struct {
 	broker     *MessageBroker
 	breaker    *CircuitBreaker
 	workerPool *WorkerPool
+	rand       RandSource
+	supervisor *Supervisor
+	errs       *ErrorCounter
+	readOnly   atomic.Bool
+
+	idempotencyKeys map[string]idempotentOrder // guarded by mu
+	idempotencyTTL  time.Duration
+}
+
+// defaultIdempotencyTTL is how long an Idempotency-Key maps to its order
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// idempotentOrder remembers which order a key created and until when
+type idempotentOrder struct {
+	orderID int
+	expires time.Time
 }
 
 // NewOrderService creates a new order service
@@ -372,29 +1629,84 @@ func NewOrderService(broker *MessageBroker) *OrderService {
 	os := &OrderService{
 		orders:     make(map[int]*Order),
 		broker:     broker,
-		breaker:    NewCircuitBreaker("order-service", 5, 60*time.Second),
+		breaker:    NewCircuitBreaker("order-service", 5, 2, 60*time.Second),
 		workerPool: NewWorkerPool(3, 100),
+		rand:       globalRand{},
+		supervisor: NewSupervisor(),
+		errs:       NewErrorCounter(),
+
+		idempotencyKeys: make(map[string]idempotentOrder),
+		idempotencyTTL:  defaultIdempotencyTTL,
 	}
 
 	os.workerPool.Start()
+	os.supervisor.Go(func(ctx context.Context) {
+		os.runReconciler(ctx, 1*time.Second)
+	})
 	return os
 }
 
-// CreateOrder creates a new order
-func (os *OrderService) CreateOrder(userID int, product string, amount float64) (*Order, error) {
-	var order *Order
+// Shutdown stops the reconciler and then the worker pool
+func (os *OrderService) Shutdown(timeout time.Duration) error {
+	if err := os.supervisor.Shutdown(timeout); err != nil {
+		return fmt.Errorf("failed to stop order service: %w", err)
+	}
+	if err := os.workerPool.StopWithTimeout(timeout); err != nil {
+		return fmt.Errorf("failed to stop order service: %w", err)
+	}
+	return nil
+}
+
+// SetRandSource replaces the source used to simulate failures.
+// Call it before the service starts handling requests.
+func (os *OrderService) SetRandSource(r RandSource) {
+	os.rand = r
+}
+
+// SetReadOnly toggles maintenance mode: writes fail with ErrReadOnly
+// while reads keep working
+func (os *OrderService) SetReadOnly(readOnly bool) {
+	os.readOnly.Store(readOnly)
+}
+
+// SetIdempotencyTTL changes how long idempotency keys are remembered
+func (os *OrderService) SetIdempotencyTTL(ttl time.Duration) {
+	os.mu.Lock()
+	defer os.mu.Unlock()
+	os.idempotencyTTL = ttl
+}
+
+// CreateOrder creates a new order. A non-empty idempotencyKey seen within
+// the TTL returns a copy of the order it created instead of a new one.
+func (os *OrderService) CreateOrder(idempotencyKey string, userID int, product string, amount float64) (*Order, error) {
+	if os.readOnly.Load() {
+		os.errs.Record("CreateOrder", ErrReadOnly)
+		return nil, ErrReadOnly
+	}
+
+	// order is the stored, live order; created is the snapshot handed to
+	// callers and subscribers, since the worker keeps updating order
+	var order, created *Order
+	var degraded, replayed bool
 	var err error
 
 	err = os.breaker.Execute(func() error {
 		os.mu.Lock()
 		defer os.mu.Unlock()
 
+		// A retried request gets the order its first attempt created
+		if existing := os.orderForKey(idempotencyKey); existing != nil {
+			created = DeepCopy(existing)
+			replayed = true
+			return nil
+		}
+
 		// Simulate processing time
 		time.Sleep(10 * time.Millisecond)
 
 		// Simulate potential failure
-		if rand.Float64() < 0.05 {
-			return fmt.Errorf("random failure in order creation")
+		if os.rand.Float64() < 0.05 {
+			return fmt.Errorf("%w in order creation", ErrSimulatedFailure)
 		}
 
 		id := len(os.orders) + 1
@@ -403,43 +1715,86 @@ func (os *OrderService) CreateOrder(userID int, product string, amount float64)
 			UserID:  userID,
 			Product: product,
 			Amount:  amount,
-			Status:  "pending",
+			Status:  OrderPending,
 			Created: time.Now(),
 		}
 
+		// Degraded mode: accept the order but defer processing
+		if os.workerPool.Overloaded() {
+			order.Status = OrderDegraded
+			degraded = true
+		}
+
 		os.orders[id] = order
+		os.rememberKey(idempotencyKey, id)
+		created = DeepCopy(order)
 		return nil
 	})
 
 	if err != nil {
+		os.errs.Record("CreateOrder", err)
 		return nil, err
 	}
+	if replayed {
+		return created, nil
+	}
 
-	// Process order asynchronously
-	os.processOrderAsync(order)
+	os.broker.Publish("order.created", created)
 
-	// Publish order created event
-	os.broker.Publish("order.created", order)
+	// Process order asynchronously unless we're shedding load
+	if !degraded {
+		os.processOrderAsync(order)
+	} else {
+		log.Printf("Worker pool overloaded, order %d queued in degraded mode", order.ID)
+	}
 
-	return order, nil
+	return created, nil
+}
+
+// orderForKey returns the unexpired order created under key, if any.
+// Callers must hold os.mu.
+func (os *OrderService) orderForKey(key string) *Order {
+	if key == "" {
+		return nil
+	}
+	entry, ok := os.idempotencyKeys[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil
+	}
+	return os.orders[entry.orderID]
+}
+
+// rememberKey maps key to orderID for idempotencyTTL, sweeping out expired
+// keys as it goes. Callers must hold os.mu.
+func (os *OrderService) rememberKey(key string, orderID int) {
+	if key == "" {
+		return
+	}
+	now := time.Now()
+	for k, entry := range os.idempotencyKeys {
+		if now.After(entry.expires) {
+			delete(os.idempotencyKeys, k)
+		}
+	}
+	os.idempotencyKeys[key] = idempotentOrder{orderID: orderID, expires: now.Add(os.idempotencyTTL)}
 }
 
 // processOrderAsync processes an order asynchronously
 func (os *OrderService) processOrderAsync(order *Order) {
 	job := Job{
-		ID: fmt.Sprintf("order-%d", order.ID),
+		ID:   fmt.Sprintf("order-%d", order.ID),
+		Type: "order",
 		Task: func() error {
+			if !os.transition(order, OrderProcessing) {
+				return nil
+			}
+
 			// Simulate order processing
 			time.Sleep(100 * time.Millisecond)
 
-			os.mu.Lock()
-			defer os.mu.Unlock()
-
-			if storedOrder, exists := os.orders[order.ID]; exists {
-				storedOrder.Status = "completed"
-
+			if os.transition(order, OrderCompleted) {
 				// Publish order completed event
-				os.broker.Publish("order.completed", storedOrder)
+				os.broker.Publish("order.completed", order)
 			}
 
 			return nil
@@ -450,92 +1805,475 @@ func (os *OrderService) processOrderAsync(order *Order) {
 	os.workerPool.Submit(job)
 }
 
+// transition moves order to next if the state graph allows it, reporting
+// whether it did
+func (os *OrderService) transition(order *Order, next OrderStatus) bool {
+	if err := os.setStatus(order, next); err != nil {
+		log.Print(err)
+		return false
+	}
+	return true
+}
+
+// UpdateStatus moves an order to the named status on behalf of a caller.
+// Any edge in the order state graph is allowed; anything else fails with
+// an *InvalidTransitionError.
+func (os *OrderService) UpdateStatus(orderID int, newStatus string) error {
+	if os.readOnly.Load() {
+		os.errs.Record("UpdateStatus", ErrReadOnly)
+		return ErrReadOnly
+	}
+
+	next, err := ParseOrderStatus(newStatus)
+	if err != nil {
+		return err
+	}
+
+	os.mu.RLock()
+	order, exists := os.orders[orderID]
+	os.mu.RUnlock()
+	if !exists {
+		err := fmt.Errorf("order %w", ErrNotFound)
+		os.errs.Record("UpdateStatus", err)
+		return err
+	}
+
+	if err := os.setStatus(order, next); err != nil {
+		os.errs.Record("UpdateStatus", err)
+		return err
+	}
+
+	// A degraded order put back to pending has no job queued for it yet
+	if next == OrderPending {
+		os.processOrderAsync(order)
+	}
+	return nil
+}
+
+// setStatus applies a legal status change and publishes
+// order.status_changed once the lock is released. A cancelled order also
+// publishes order.failed so the user hears it won't be fulfilled.
+func (os *OrderService) setStatus(order *Order, next OrderStatus) error {
+	os.mu.Lock()
+	from := order.Status
+	if !from.CanTransitionTo(next) {
+		os.mu.Unlock()
+		return &InvalidTransitionError{OrderID: order.ID, From: from, To: next}
+	}
+	order.Status = next
+	snapshot := DeepCopy(order)
+	os.mu.Unlock()
+
+	os.broker.Publish("order.status_changed", OrderStatusChange{OrderID: order.ID, From: from, To: next})
+	if next == OrderCancelled {
+		os.broker.Publish("order.failed", snapshot)
+	}
+	return nil
+}
+
+// OrderRequest describes a single order to create
+type OrderRequest struct {
+	UserID  int     `json:"user_id"`
+	Product string  `json:"product"`
+	Amount  float64 `json:"amount"`
+}
+
+// CreateOrders creates orders one by one, stopping as soon as ctx is
+// cancelled. It returns the orders created so far along with any error.
+func (os *OrderService) CreateOrders(ctx context.Context, reqs []OrderRequest) ([]*Order, error) {
+	orders := make([]*Order, 0, len(reqs))
+
+	for _, req := range reqs {
+		if err := ctx.Err(); err != nil {
+			os.errs.Record("CreateOrders", err)
+			return orders, err
+		}
+
+		order, err := os.CreateOrder("", req.UserID, req.Product, req.Amount)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// runReconciler periodically retries orders accepted in degraded mode
+// until ctx is cancelled
+func (os *OrderService) runReconciler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			os.reconcileDegradedOrders()
+		}
+	}
+}
+
+// reconcileDegradedOrders submits degraded orders for processing while the
+// worker pool has spare capacity
+func (os *OrderService) reconcileDegradedOrders() {
+	os.mu.Lock()
+	var pending []*Order
+	for _, order := range os.orders {
+		if order.Status == OrderDegraded {
+			pending = append(pending, order)
+		}
+	}
+	os.mu.Unlock()
+
+	for _, order := range pending {
+		if os.workerPool.Overloaded() {
+			return
+		}
+
+		if os.transition(order, OrderPending) {
+			os.processOrderAsync(order)
+		}
+	}
+}
+
 // GetOrder retrieves an order by ID
 func (os *OrderService) GetOrder(id int) (*Order, error) {
 	os.mu.RLock()
 	defer os.mu.RUnlock()
 
-	order, exists := os.orders[id]
-	if !exists {
-		return nil, fmt.Errorf("order not found")
+	order, exists := os.orders[id]
+	if !exists {
+		err := fmt.Errorf("order %w", ErrNotFound)
+		os.errs.Record("GetOrder", err)
+		return nil, err
+	}
+
+	// Hand out a copy so callers can't mutate the stored order
+	return DeepCopy(order), nil
+}
+
+// GetAll returns copies of every order, ordered by ID
+func (os *OrderService) GetAll() []*Order {
+	os.mu.RLock()
+	defer os.mu.RUnlock()
+
+	orders := make([]*Order, 0, len(os.orders))
+	for _, order := range os.orders {
+		orders = append(orders, DeepCopy(order))
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders
+}
+
+// defaultMaxNotifications bounds the notification store when no limit is given
+const defaultMaxNotifications = 1000
+
+// maxConcurrentSends caps outbound notification deliveries in flight
+const maxConcurrentSends = 10
+
+// maxDeliveryAttempts is how often a notification is tried before it is
+// left in the dead-letter list for good
+const maxDeliveryAttempts = 4
+
+// maxDeadLetters bounds the dead-letter list; the oldest entries are
+// evicted first
+const maxDeadLetters = 100
+
+// deadLetterBackoff is the wait before the first retry; it doubles after
+// every further failure
+const deadLetterBackoff = 200 * time.Millisecond
+
+// NotificationSender delivers one notification over its channel
+type NotificationSender func(notification *Notification) error
+
+// simulateSend stands in for a real email/SMS/push gateway: it takes a
+// little while and occasionally fails
+func (ns *NotificationService) simulateSend(notification *Notification) error {
+	time.Sleep(50 * time.Millisecond)
+	if ns.rand.Float64() < 0.05 {
+		return fmt.Errorf("%w sending %s", ErrSimulatedFailure, notification.Type)
+	}
+	return nil
+}
+
+// NotificationRules maps an event topic to the channels ("email", "push",
+// "sms", ...) that should be notified when it is published
+type NotificationRules map[string][]string
+
+// ErrUnknownTopic is returned for notification rules on an event the
+// service can't build a notification for
+var ErrUnknownTopic = errors.New("no notification for topic")
+
+// notificationTopics are the events processMessages turns into
+// notifications; rules may only route these
+var notificationTopics = map[string]bool{
+	"user.created":    true,
+	"order.created":   true,
+	"order.completed": true,
+	"order.failed":    true,
+}
+
+// DefaultNotificationRules is used when no rules are given
+var DefaultNotificationRules = NotificationRules{
+	"user.created":    {"email"},
+	"order.created":   {"email"},
+	"order.completed": {"email", "push"},
+	"order.failed":    {"sms"},
+}
+
+// NotificationService handles notification operations
+type NotificationService struct {
+	notifications []*Notification // ring buffer, oldest evicted first
+	head          int
+	count         int
+	nextID        int
+	mu            sync.RWMutex
+	broker        *MessageBroker
+	messageQueue  chan Message
+	sendSlots     *Semaphore
+	rules         NotificationRules
+	subs          []*Subscription
+	processing    sync.WaitGroup // the processMessages goroutine
+	sending       sync.WaitGroup // sendNotification goroutines
+	reprocessing  sync.WaitGroup // the reprocessDeadLetters goroutine
+	stopOnce      sync.Once
+
+	sender      NotificationSender
+	rand        RandSource
+	deadLetter  chan *Notification    // failed sends, drained by reprocessDeadLetters
+	deadLetters map[int]*Notification // every notification whose last send failed
+	retries     map[int]*time.Timer   // scheduled retries, guarded by mu
+	stopped     bool                  // no retries are scheduled once set, guarded by mu
+}
+
+// NewNotificationService creates a new notification service that keeps at
+// most maxNotifications entries and routes events according to rules.
+// Rules for a topic outside notificationTopics fail with ErrUnknownTopic.
+func NewNotificationService(broker *MessageBroker, maxNotifications int, rules NotificationRules) (*NotificationService, error) {
+	if maxNotifications <= 0 {
+		maxNotifications = defaultMaxNotifications
+	}
+	if rules == nil {
+		rules = DefaultNotificationRules
+	}
+	for topic := range rules {
+		if !notificationTopics[topic] {
+			return nil, fmt.Errorf("%w %q", ErrUnknownTopic, topic)
+		}
+	}
+
+	ns := &NotificationService{
+		notifications: make([]*Notification, maxNotifications),
+		broker:        broker,
+		messageQueue:  make(chan Message, 100),
+		sendSlots:     NewSemaphore(maxConcurrentSends),
+		rules:         rules,
+		rand:          globalRand{},
+		deadLetter:    make(chan *Notification, maxDeadLetters),
+		deadLetters:   make(map[int]*Notification),
+		retries:       make(map[int]*time.Timer),
+	}
+	ns.sender = ns.simulateSend
+
+	// Subscribe to every routed event
+	for topic := range rules {
+		ns.subs = append(ns.subs, ns.broker.Subscribe(topic, ns.messageQueue))
+	}
+
+	// Start message processor
+	ns.processing.Add(1)
+	go func() {
+		defer ns.processing.Done()
+		ns.processMessages()
+	}()
+
+	// Start dead-letter reprocessor
+	ns.reprocessing.Add(1)
+	go func() {
+		defer ns.reprocessing.Done()
+		ns.reprocessDeadLetters()
+	}()
+
+	return ns, nil
+}
+
+// SetSender replaces how notifications are delivered, e.g. with a sender
+// that always fails in tests. Call it before any events are published.
+func (ns *NotificationService) SetSender(sender NotificationSender) {
+	ns.sender = sender
+}
+
+// SetRandSource replaces the source the default sender uses to simulate
+// failures. Call it before any events are published.
+func (ns *NotificationService) SetRandSource(r RandSource) {
+	ns.rand = r
+}
+
+// DeadLetters returns the notifications whose most recent delivery
+// attempt failed, oldest first. They leave the list once a retry succeeds
+// or when newer failures push them out.
+func (ns *NotificationService) DeadLetters() []*Notification {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	result := make([]*Notification, 0, len(ns.deadLetters))
+	for _, notification := range ns.deadLetters {
+		result = append(result, DeepCopy(notification))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// scheduleRetry sends notification again after deadLetterBackoff, doubled
+// for every attempt already made. Each retry has its own timer, so a long
+// backoff doesn't hold up the others. Callers must hold ns.mu.
+func (ns *NotificationService) scheduleRetry(notification *Notification) {
+	if ns.stopped {
+		return
 	}
 
-	return order, nil
-}
+	backoff := deadLetterBackoff << (notification.Attempts - 1)
+	ns.retries[notification.ID] = time.AfterFunc(backoff, func() {
+		ns.mu.Lock()
+		if ns.stopped {
+			ns.mu.Unlock()
+			return
+		}
+		delete(ns.retries, notification.ID)
+		ns.sending.Add(1)
+		ns.mu.Unlock()
 
-// NotificationService handles notification operations
-type NotificationService struct {
-	notifications map[int]*Notification
-	mu            sync.RWMutex
-	broker        *MessageBroker
-	messageQueue  chan Message
+		defer ns.sending.Done()
+		ns.sendNotification(notification)
+	})
 }
 
-// NewNotificationService creates a new notification service
-func NewNotificationService(broker *MessageBroker) *NotificationService {
-	ns := &NotificationService{
-		notifications: make(map[int]*Notification),
-		broker:        broker,
-		messageQueue:  make(chan Message, 100),
+// addDeadLetter records a failed notification, evicting the oldest entry
+// once the list is full. Callers must hold ns.mu.
+func (ns *NotificationService) addDeadLetter(notification *Notification) {
+	ns.deadLetters[notification.ID] = notification
+	if len(ns.deadLetters) <= maxDeadLetters {
+		return
+	}
+
+	oldest := notification.ID
+	for id := range ns.deadLetters {
+		oldest = min(oldest, id)
 	}
+	delete(ns.deadLetters, oldest)
+	if timer, ok := ns.retries[oldest]; ok {
+		timer.Stop()
+		delete(ns.retries, oldest)
+	}
+}
+
+// Stop unsubscribes from every topic, lets the processor finish the
+// messages already queued and waits for their notifications to be sent
+func (ns *NotificationService) Stop() {
+	ns.stopOnce.Do(func() {
+		for _, sub := range ns.subs {
+			sub.Unsubscribe()
+		}
+		// Publish can no longer reach the queue, so closing it is safe
+		close(ns.messageQueue)
+		ns.processing.Wait()
+
+		// Retries still waiting stay in DeadLetters
+		ns.mu.Lock()
+		ns.stopped = true
+		for id, timer := range ns.retries {
+			timer.Stop()
+			delete(ns.retries, id)
+		}
+		ns.mu.Unlock()
 
-	// Subscribe to events
-	ns.broker.Subscribe("user.created", ns.messageQueue)
-	ns.broker.Subscribe("order.created", ns.messageQueue)
-	ns.broker.Subscribe("order.completed", ns.messageQueue)
+		ns.sending.Wait()
 
-	// Start message processor
-	go ns.processMessages()
+		// No sends are left to fail, so nothing writes to deadLetter
+		close(ns.deadLetter)
+		ns.reprocessing.Wait()
+	})
+}
 
-	return ns
+// reprocessDeadLetters schedules a retry with backoff for every failed
+// notification pushed onto the dead-letter channel
+func (ns *NotificationService) reprocessDeadLetters() {
+	for notification := range ns.deadLetter {
+		ns.mu.Lock()
+		// Skip entries evicted from the list while they were queued
+		if _, listed := ns.deadLetters[notification.ID]; listed {
+			ns.scheduleRetry(notification)
+		}
+		ns.mu.Unlock()
+	}
 }
 
-// processMessages processes incoming messages
+// processMessages turns each event in notificationTopics into the
+// notifications its rules ask for
 func (ns *NotificationService) processMessages() {
 	for message := range ns.messageQueue {
 		switch message.Topic {
 		case "user.created":
-			if user, ok := message.Payload.(*User); ok {
+			if user, err := DecodePayload[*User](message); err == nil {
 				ns.sendWelcomeNotification(user)
 			}
 		case "order.created":
-			if order, ok := message.Payload.(*Order); ok {
+			if order, err := DecodePayload[*Order](message); err == nil {
 				ns.sendOrderConfirmation(order)
 			}
 		case "order.completed":
-			if order, ok := message.Payload.(*Order); ok {
+			if order, err := DecodePayload[*Order](message); err == nil {
 				ns.sendOrderCompletion(order)
 			}
+		case "order.failed":
+			if order, err := DecodePayload[*Order](message); err == nil {
+				ns.sendOrderFailure(order)
+			}
 		}
 	}
 }
 
 // sendWelcomeNotification sends a welcome notification
 func (ns *NotificationService) sendWelcomeNotification(user *User) {
-	ns.createNotification(user.ID, "email",
+	ns.route("user.created", user.ID,
 		fmt.Sprintf("Welcome %s! Your account has been created.", user.Name))
 }
 
 // sendOrderConfirmation sends an order confirmation
 func (ns *NotificationService) sendOrderConfirmation(order *Order) {
-	ns.createNotification(order.UserID, "email",
+	ns.route("order.created", order.UserID,
 		fmt.Sprintf("Order #%d confirmed for %s ($%.2f)", order.ID, order.Product, order.Amount))
 }
 
 // sendOrderCompletion sends an order completion notification
 func (ns *NotificationService) sendOrderCompletion(order *Order) {
-	ns.createNotification(order.UserID, "email",
+	ns.route("order.completed", order.UserID,
 		fmt.Sprintf("Order #%d completed! Your %s is ready.", order.ID, order.Product))
 }
 
+// sendOrderFailure tells the user their order could not be processed
+func (ns *NotificationService) sendOrderFailure(order *Order) {
+	ns.route("order.failed", order.UserID,
+		fmt.Sprintf("Order #%d for %s was cancelled and will not be fulfilled.", order.ID, order.Product))
+}
+
+// route creates one notification per channel configured for topic
+func (ns *NotificationService) route(topic string, userID int, message string) {
+	for _, channel := range ns.rules[topic] {
+		ns.createNotification(userID, channel, message)
+	}
+}
+
 // createNotification creates a new notification
 func (ns *NotificationService) createNotification(userID int, notificationType, message string) {
 	ns.mu.Lock()
 	defer ns.mu.Unlock()
 
-	id := len(ns.notifications) + 1
+	ns.nextID++
 	notification := &Notification{
-		ID:      id,
+		ID:      ns.nextID,
 		UserID:  userID,
 		Type:    notificationType,
 		Message: message,
@@ -543,39 +2281,114 @@ func (ns *NotificationService) createNotification(userID int, notificationType,
 		Created: time.Now(),
 	}
 
-	ns.notifications[id] = notification
+	ns.store(notification)
 
 	// Simulate sending notification
-	go ns.sendNotification(notification)
+	ns.sending.Add(1)
+	go func() {
+		defer ns.sending.Done()
+		ns.sendNotification(notification)
+	}()
 }
 
-// sendNotification simulates sending a notification
+// sendNotification delivers a notification. On failure it is listed in
+// DeadLetters and pushed onto the dead-letter channel for a retry instead
+// of being marked sent.
 func (ns *NotificationService) sendNotification(notification *Notification) {
-	// Simulate network delay
-	time.Sleep(50 * time.Millisecond)
+	if err := ns.sendSlots.Acquire(context.Background()); err != nil {
+		return
+	}
+	defer ns.sendSlots.Release()
+
+	err := ns.sender(notification)
 
 	ns.mu.Lock()
-	defer ns.mu.Unlock()
+	notification.Attempts++
+	if err == nil {
+		notification.Sent = true
+		delete(ns.deadLetters, notification.ID)
+		ns.mu.Unlock()
+		log.Printf("Notification sent: %s", notification.Message)
+		return
+	}
+
+	ns.addDeadLetter(notification)
+	attempts := notification.Attempts
+	ns.mu.Unlock()
+
+	if attempts >= maxDeliveryAttempts {
+		log.Printf("Notification %d failed %d times, giving up: %v", notification.ID, attempts, err)
+		return
+	}
+
+	// Sent outside the lock: the reprocessor needs ns.mu to drain it
+	ns.deadLetter <- notification
+	log.Printf("Notification %d failed, queued for retry: %v", notification.ID, err)
+}
+
+// store appends a notification, overwriting the oldest when full.
+// Callers must hold ns.mu.
+func (ns *NotificationService) store(notification *Notification) {
+	capacity := len(ns.notifications)
+	idx := (ns.head + ns.count) % capacity
+	ns.notifications[idx] = notification
+
+	if ns.count < capacity {
+		ns.count++
+	} else {
+		ns.head = (ns.head + 1) % capacity
+	}
+}
+
+// ListRecent returns copies of up to n notifications, newest first
+func (ns *NotificationService) ListRecent(n int) []*Notification {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	if n > ns.count {
+		n = ns.count
+	}
+	if n <= 0 {
+		return nil
+	}
 
-	notification.Sent = true
-	log.Printf("Notification sent: %s", notification.Message)
+	capacity := len(ns.notifications)
+	result := make([]*Notification, 0, n)
+	for i := 0; i < n; i++ {
+		idx := (ns.head + ns.count - 1 - i) % capacity
+		result = append(result, DeepCopy(ns.notifications[idx]))
+	}
+	return result
 }
 
 // === HEALTH CHECK SYSTEM ===
 
 // HealthChecker provides health check functionality
 type HealthChecker struct {
-	checks map[string]func() error
-	mu     sync.RWMutex
+	checks  map[string]func() error
+	timeout time.Duration
+	mu      sync.RWMutex
 }
 
+// defaultHealthCheckTimeout is how long a single check may take before it
+// is reported as timed out
+const defaultHealthCheckTimeout = 2 * time.Second
+
 // NewHealthChecker creates a new health checker
 func NewHealthChecker() *HealthChecker {
 	return &HealthChecker{
-		checks: make(map[string]func() error),
+		checks:  make(map[string]func() error),
+		timeout: defaultHealthCheckTimeout,
 	}
 }
 
+// SetTimeout changes how long each check may run
+func (hc *HealthChecker) SetTimeout(timeout time.Duration) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.timeout = timeout
+}
+
 // RegisterCheck registers a health check
 func (hc *HealthChecker) RegisterCheck(name string, check func() error) {
 	hc.mu.Lock()
@@ -583,22 +2396,380 @@ func (hc *HealthChecker) RegisterCheck(name string, check func() error) {
 	hc.checks[name] = check
 }
 
-// CheckHealth performs all health checks
-func (hc *HealthChecker) CheckHealth() map[string]string {
-	hc.mu.RLock()
-	defer hc.mu.RUnlock()
+// Overall health statuses: every check passed, some failed, or all failed
+const (
+	StatusHealthy   = "healthy"
+	StatusDegraded  = "degraded"
+	StatusUnhealthy = "unhealthy"
+)
+
+// CheckResult is the outcome of one health check and how long it took
+type CheckResult struct {
+	Status  string        `json:"status"`
+	Latency time.Duration `json:"latency"`
+}
+
+// HealthReport is the overall status plus every check's result by name
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
 
-	results := make(map[string]string)
+// Healthy reports whether every check passed
+func (r HealthReport) Healthy() bool {
+	return r.Status == StatusHealthy
+}
 
+// CheckHealth runs all health checks concurrently, so it takes about as
+// long as the slowest check, and never much longer than the timeout
+func (hc *HealthChecker) CheckHealth() HealthReport {
+	hc.mu.RLock()
+	timeout := hc.timeout
+	checks := make(map[string]func() error, len(hc.checks))
 	for name, check := range hc.checks {
-		if err := check(); err != nil {
-			results[name] = fmt.Sprintf("unhealthy: %v", err)
-		} else {
-			results[name] = "healthy"
+		checks[name] = check
+	}
+	hc.mu.RUnlock()
+
+	type namedResult struct {
+		name   string
+		result CheckResult
+	}
+	results := make(chan namedResult, len(checks))
+	for name, check := range checks {
+		go func(name string, check func() error) {
+			results <- namedResult{name, runCheck(check, timeout)}
+		}(name, check)
+	}
+
+	report := HealthReport{Checks: make(map[string]CheckResult, len(checks))}
+	failed := 0
+	for range checks {
+		r := <-results
+		report.Checks[r.name] = r.result
+		if r.result.Status != StatusHealthy {
+			failed++
+		}
+	}
+
+	switch {
+	case failed == 0:
+		report.Status = StatusHealthy
+	case failed < len(checks):
+		report.Status = StatusDegraded
+	default:
+		report.Status = StatusUnhealthy
+	}
+
+	return report
+}
+
+// runCheck runs check and times it, giving up after timeout. A check that
+// times out is left to finish in the background and its result ignored.
+func runCheck(check func() error, timeout time.Duration) CheckResult {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+
+	select {
+	case err := <-done:
+		result := CheckResult{Status: StatusHealthy, Latency: time.Since(start)}
+		if err != nil {
+			result.Status = fmt.Sprintf("unhealthy: %v", err)
+		}
+		return result
+	case <-time.After(timeout):
+		return CheckResult{Status: "unhealthy: timeout", Latency: time.Since(start)}
+	}
+}
+
+// === HTTP CLIENT HELPERS ===
+
+// defaultRequestTimeout bounds outbound calls whose context has no deadline
+const defaultRequestTimeout = 10 * time.Second
+
+// HTTPStatusError is returned when a service responds with a non-2xx status
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}
+
+// JSONGet fetches url and decodes the JSON response into a T
+func JSONGet[T any](ctx context.Context, client *http.Client, url string) (T, error) {
+	var result T
+	err := doJSON(ctx, client, http.MethodGet, url, nil, &result)
+	return result, err
+}
+
+// JSONPost encodes body as JSON, posts it to url and decodes the response
+func JSONPost[TReq, TResp any](ctx context.Context, client *http.Client, url string, body TReq) (TResp, error) {
+	var result TResp
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return result, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	err = doJSON(ctx, client, http.MethodPost, url, bytes.NewReader(payload), &result)
+	return result, err
+}
+
+// doJSON performs the request and maps non-2xx responses to HTTPStatusError
+func doJSON(ctx context.Context, client *http.Client, method, url string, body io.Reader, out interface{}) error {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &HTTPStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// ServiceClient calls another service's JSON API through a circuit breaker,
+// so a dependency that keeps failing is short-circuited instead of waited on
+type ServiceClient struct {
+	client  *http.Client
+	breaker *CircuitBreaker
+}
+
+// NewServiceClient creates a client that sends requests with client and
+// guards them with breaker
+func NewServiceClient(client *http.Client, breaker *CircuitBreaker) *ServiceClient {
+	return &ServiceClient{client: client, breaker: breaker}
+}
+
+// ServiceGet fetches url with JSONGet through sc's breaker
+func ServiceGet[T any](ctx context.Context, sc *ServiceClient, url string) (T, error) {
+	var result T
+	err := sc.guard(func() error {
+		var err error
+		result, err = JSONGet[T](ctx, sc.client, url)
+		return err
+	})
+	return result, err
+}
+
+// ServicePost posts body with JSONPost through sc's breaker
+func ServicePost[TReq, TResp any](ctx context.Context, sc *ServiceClient, url string, body TReq) (TResp, error) {
+	var result TResp
+	err := sc.guard(func() error {
+		var err error
+		result, err = JSONPost[TReq, TResp](ctx, sc.client, url, body)
+		return err
+	})
+	return result, err
+}
+
+// guard runs call inside the breaker. A 4xx response is the caller's
+// mistake rather than the service failing, so it is returned as an
+// HTTPStatusError without counting against the breaker.
+func (sc *ServiceClient) guard(call func() error) error {
+	var result error
+	err := sc.breaker.Execute(func() error {
+		result = call()
+
+		var statusErr *HTTPStatusError
+		if errors.As(result, &statusErr) && statusErr.StatusCode < 500 {
+			return nil
+		}
+		return result
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// RetryTransport is an http.RoundTripper that retries idempotent requests
+// (GET/HEAD) on connection errors, 5xx and 429 responses, with exponential
+// backoff. A Retry-After header on the response overrides the backoff.
+type RetryTransport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// NewRetryTransport wraps base (http.DefaultTransport if nil)
+func NewRetryTransport(base http.RoundTripper, maxRetries int, backoff time.Duration) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RetryTransport{Base: base, MaxRetries: maxRetries, Backoff: backoff}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return t.Base.RoundTrip(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.Base.RoundTrip(req)
+
+		retryable := err != nil ||
+			resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		if !retryable || attempt >= t.MaxRetries {
+			return resp, err
+		}
+
+		delay := t.Backoff << attempt
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			// Drain so the connection can be reused for the next attempt
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// parseRetryAfter understands both delay-seconds and HTTP-date forms
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		delay := time.Until(when)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// === CONTEXT HELPERS ===
+
+// contextKey is unexported so other packages can't collide with our keys
+type contextKey int
+
+const (
+	startTimeKey contextKey = iota
+)
+
+// Inject returns middleware that stores value under key in every request context
+func Inject[T any](key contextKey, value T) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(w, r.WithContext(context.WithValue(r.Context(), key, value)))
+		}
+	}
+}
+
+// MustGet returns the T stored under key, panicking if it is missing.
+// Only use it for values a middleware is guaranteed to have injected.
+func MustGet[T any](ctx context.Context, key contextKey) T {
+	value, ok := As[T](ctx.Value(key))
+	if !ok {
+		panic(fmt.Sprintf("context value for key %v is missing or not a %T", key, value))
+	}
+	return value
+}
+
+// === PAGINATION ===
+
+// Page is one window of a larger list plus the metadata needed to fetch more
+type Page[T any] struct {
+	Items   []T  `json:"items"`
+	Total   int  `json:"total"`
+	Offset  int  `json:"offset"`
+	Limit   int  `json:"limit"`
+	HasMore bool `json:"has_more"`
+}
+
+// defaultPageLimit is used when a list request doesn't specify ?limit
+const defaultPageLimit = 20
+
+// maxPageLimit caps ?limit; larger values are clamped to it
+const maxPageLimit = 100
+
+// ErrInvalidPagination is wrapped by parsePagination errors (map to 400)
+var ErrInvalidPagination = errors.New("invalid pagination")
+
+// parsePagination reads ?offset= and ?limit=. Missing values use defaults
+// and a limit above maxPageLimit is clamped; anything else out of range
+// returns an error wrapping ErrInvalidPagination.
+func parsePagination(r *http.Request) (offset, limit int, err error) {
+	query := r.URL.Query()
+
+	if raw := query.Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("%w: offset must be a non-negative integer, got %q", ErrInvalidPagination, raw)
+		}
+	}
+
+	limit = defaultPageLimit
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("%w: limit must be a positive integer, got %q", ErrInvalidPagination, raw)
 		}
 	}
 
-	return results
+	return offset, min(limit, maxPageLimit), nil
+}
+
+// Paginate returns items[offset:offset+limit] as a Page. Out-of-range
+// offsets yield an empty page rather than an error.
+func Paginate[T any](items []T, offset, limit int) Page[T] {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+
+	start := min(offset, len(items))
+	end := min(start+limit, len(items))
+
+	return Page[T]{
+		Items:   append([]T{}, items[start:end]...),
+		Total:   len(items),
+		Offset:  offset,
+		Limit:   limit,
+		HasMore: end < len(items),
+	}
 }
 
 // === API GATEWAY ===
@@ -609,45 +2780,111 @@ type APIGateway struct {
 	orderService        *OrderService
 	notificationService *NotificationService
 	healthChecker       *HealthChecker
+	breakers            *BreakerRegistry
+	adminToken          string        // bearer token for /admin routes; empty disables them
+	httpClient          *http.Client  // for outbound calls to other services
+	stopping            chan struct{} // closed when the server starts shutting down
 }
 
 // NewAPIGateway creates a new API gateway
 func NewAPIGateway(userService *UserService, orderService *OrderService,
-	notificationService *NotificationService, healthChecker *HealthChecker) *APIGateway {
+	notificationService *NotificationService, healthChecker *HealthChecker,
+	breakers *BreakerRegistry, adminToken string) *APIGateway {
 	return &APIGateway{
 		userService:         userService,
 		orderService:        orderService,
 		notificationService: notificationService,
 		healthChecker:       healthChecker,
+		breakers:            breakers,
+		adminToken:          adminToken,
+		httpClient: &http.Client{
+			Transport: NewRetryTransport(http.DefaultTransport, 3, 100*time.Millisecond),
+			Timeout:   defaultRequestTimeout,
+		},
+		stopping: make(chan struct{}),
+	}
+}
+
+// PeerHealthCheck returns a health check that fetches url, typically
+// another service's /health, through the gateway's retrying client. Each
+// peer gets its own breaker so one that is down fails fast.
+func (ag *APIGateway) PeerHealthCheck(name, url string) func() error {
+	client := NewServiceClient(ag.httpClient, NewCircuitBreaker(name, 3, 1, 30*time.Second))
+	return func() error {
+		_, err := ServiceGet[map[string]interface{}](context.Background(), client, url)
+		return err
 	}
 }
 
-// StartServer starts the HTTP server
-func (ag *APIGateway) StartServer(port string) {
-	http.HandleFunc("/health", ag.healthHandler)
-	http.HandleFunc("/users", ag.usersHandler)
-	http.HandleFunc("/orders", ag.ordersHandler)
-	http.HandleFunc("/stats", ag.statsHandler)
+// StartServer serves the API on port until ctx is cancelled, then waits up
+// to timeout for in-flight requests
+func (ag *APIGateway) StartServer(ctx context.Context, port string, timeout time.Duration) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", Inject(startTimeKey, time.Now())(ag.healthHandler))
+	mux.HandleFunc("/users", ag.usersHandler)
+	mux.HandleFunc("/orders", ag.ordersHandler)
+	mux.HandleFunc("/stats", ag.statsHandler)
+	mux.HandleFunc("/metrics", ag.metricsHandler)
+	mux.HandleFunc("GET /breakers/{name}/watch", ag.watchBreakerHandler)
+	mux.HandleFunc("POST /admin/breakers/{name}/reset", ag.requireAdmin(ag.resetBreakerHandler))
+
+	server := &http.Server{Addr: ":" + port, Handler: mux}
+	// Watch streams never finish on their own, so end them when draining starts
+	server.RegisterOnShutdown(func() { close(ag.stopping) })
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("API Gateway starting on port %s", port)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
 
-	log.Printf("API Gateway starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+	return nil
 }
 
-// healthHandler handles health check requests
+// healthHandler handles health check requests. It needs startTimeKey
+// injected.
 func (ag *APIGateway) healthHandler(w http.ResponseWriter, r *http.Request) {
-	results := ag.healthChecker.CheckHealth()
+	report := ag.healthChecker.CheckHealth()
+
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":    "ok",
-		"checks":    results,
+		"status":    report.Status,
+		"checks":    report.Checks,
 		"timestamp": time.Now().Format(time.RFC3339),
+		"uptime":    time.Since(MustGet[time.Time](r.Context(), startTimeKey)).Round(time.Second).String(),
 	})
 }
 
 // usersHandler handles user requests
 func (ag *APIGateway) usersHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
+	case "GET":
+		offset, limit, err := parsePagination(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Paginate(ag.userService.GetAll(), offset, limit))
+
 	case "POST":
 		var req struct {
 			Name  string `json:"name"`
@@ -661,7 +2898,7 @@ func (ag *APIGateway) usersHandler(w http.ResponseWriter, r *http.Request) {
 
 		user, err := ag.userService.CreateUser(req.Name, req.Email)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), statusForError(err))
 			return
 		}
 
@@ -676,6 +2913,16 @@ func (ag *APIGateway) usersHandler(w http.ResponseWriter, r *http.Request) {
 // ordersHandler handles order requests
 func (ag *APIGateway) ordersHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
+	case "GET":
+		offset, limit, err := parsePagination(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Paginate(ag.orderService.GetAll(), offset, limit))
+
 	case "POST":
 		var req struct {
 			UserID  int     `json:"user_id"`
@@ -688,9 +2935,9 @@ func (ag *APIGateway) ordersHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		order, err := ag.orderService.CreateOrder(req.UserID, req.Product, req.Amount)
+		order, err := ag.orderService.CreateOrder(r.Header.Get("Idempotency-Key"), req.UserID, req.Product, req.Amount)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), statusForError(err))
 			return
 		}
 
@@ -702,11 +2949,87 @@ func (ag *APIGateway) ordersHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// requireAdmin rejects requests that don't carry the admin bearer token
+func (ag *APIGateway) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || ag.adminToken == "" || token != ag.adminToken {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// resetBreakerHandler closes the named circuit breaker and reports its state
+func (ag *APIGateway) resetBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	cb, ok := ag.breakers.Get(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("circuit breaker %s not found", name), http.StatusNotFound)
+		return
+	}
+
+	cb.Reset()
+	log.Printf("Circuit breaker %s reset by admin request", name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"name":  name,
+		"state": cb.GetState().String(),
+	})
+}
+
+// watchBreakerHandler streams the named breaker's state as server-sent
+// events, one per change, until the client disconnects
+func (ag *APIGateway) watchBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	cb, ok := ag.breakers.Get(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("circuit breaker %s not found", name), http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	states, cancel := cb.WatchState()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ag.stopping:
+			return
+		case state := <-states:
+			fmt.Fprintf(w, "data: %s\n\n", state)
+			flusher.Flush()
+		}
+	}
+}
+
+// statusForError maps a service error to an HTTP status code
+func statusForError(err error) int {
+	if errors.Is(err, ErrReadOnly) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 // statsHandler provides system statistics
 func (ag *APIGateway) statsHandler(w http.ResponseWriter, r *http.Request) {
 	stats := map[string]interface{}{
 		"user_service_circuit_breaker":  ag.userService.breaker.GetState(),
 		"order_service_circuit_breaker": ag.orderService.breaker.GetState(),
+		"order_worker_pool_jobs":        ag.orderService.workerPool.StatsByType(),
+		"order_worker_pool":             ag.orderService.workerPool.Stats(),
+		"user_service_errors":           ag.userService.errs.Snapshot(),
+		"order_service_errors":          ag.orderService.errs.Snapshot(),
 		"timestamp":                     time.Now().Format(time.RFC3339),
 	}
 
@@ -714,6 +3037,23 @@ func (ag *APIGateway) statsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+// metricsHandler provides per-operation error counts
+func (ag *APIGateway) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics := map[string]interface{}{
+		"errors": map[string]interface{}{
+			"user_service":  ag.userService.errs.Snapshot(),
+			"order_service": ag.orderService.errs.Snapshot(),
+		},
+		"errors_last_minute": map[string]int{
+			"user_service":  ag.userService.errs.RecentCount(time.Minute),
+			"order_service": ag.orderService.errs.RecentCount(time.Minute),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
+
 // === MAIN APPLICATION ===
 
 func main() {
@@ -721,11 +3061,22 @@ func main() {
 
 	// Initialize message broker
 	broker := NewMessageBroker()
+	broker.SetSerializePayloads(true)
 
 	// Initialize services
 	userService := NewUserService(broker)
 	orderService := NewOrderService(broker)
-	notificationService := NewNotificationService(broker)
+	notificationService, err := NewNotificationService(broker, defaultMaxNotifications, DefaultNotificationRules)
+	if err != nil {
+		log.Fatalf("Failed to start notification service: %v", err)
+	}
+
+	// Log breaker state changes as they happen
+	for _, cb := range []*CircuitBreaker{userService.breaker, orderService.breaker} {
+		cb.WithStateChangeHook(func(name string, from, to CircuitBreakerState) {
+			log.Printf("Circuit breaker %s: %s -> %s", name, from, to)
+		})
+	}
 
 	// Initialize health checker
 	healthChecker := NewHealthChecker()
@@ -751,7 +3102,21 @@ func main() {
 	})
 
 	// Initialize API gateway
-	gateway := NewAPIGateway(userService, orderService, notificationService, healthChecker)
+	breakers := NewBreakerRegistry(userService.breaker, orderService.breaker)
+	gateway := NewAPIGateway(userService, orderService, notificationService, healthChecker,
+		breakers, os.Getenv("ADMIN_TOKEN"))
+
+	// Services running elsewhere, e.g. PEER_HEALTH_URLS=http://inventory:8081/health
+	for _, url := range strings.Split(os.Getenv("PEER_HEALTH_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			name := "peer " + url
+			healthChecker.RegisterCheck(name, gateway.PeerHealthCheck(name, url))
+		}
+	}
+
+	// Stop on Ctrl+C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Start background demo
 	go runDemo(userService, orderService)
@@ -759,14 +3124,31 @@ func main() {
 	// Start API server
 	log.Println("Starting microservices...")
 	log.Println("API Endpoints:")
+	log.Println("GET /users - List users (?offset=&limit=)")
 	log.Println("POST /users - Create user")
-	log.Println("POST /orders - Create order")
-	log.Println("GET /health - Health check")
+	log.Println("GET /orders - List orders (?offset=&limit=)")
+	log.Println("POST /orders - Create order (optional Idempotency-Key header)")
+	log.Println("GET /health - Health check (includes PEER_HEALTH_URLS, comma-separated)")
 	log.Println("GET /stats - System statistics")
+	log.Println("GET /metrics - Error metrics")
+	log.Println("POST /admin/breakers/{name}/reset - Reset a circuit breaker (Bearer $ADMIN_TOKEN)")
 
-	gateway.StartServer("8080")
+	if err := gateway.StartServer(ctx, "8080", shutdownTimeout); err != nil {
+		log.Printf("API Gateway stopped: %v", err)
+	}
+
+	log.Println("Shutting down...")
+	if err := orderService.Shutdown(shutdownTimeout); err != nil {
+		log.Printf("Order service: %v", err)
+	}
+	// After the order service, so its last events still get notifications
+	notificationService.Stop()
+	log.Println("Shutdown complete")
 }
 
+// shutdownTimeout bounds each step of a graceful shutdown
+const shutdownTimeout = 10 * time.Second
+
 // runDemo demonstrates the microservices in action
 func runDemo(userService *UserService, orderService *OrderService) {
 	time.Sleep(2 * time.Second)
@@ -801,7 +3183,7 @@ func runDemo(userService *UserService, orderService *OrderService) {
 			product := products[rand.Intn(len(products))]
 			amount := float64(rand.Intn(1000) + 100)
 
-			order, err := orderService.CreateOrder(user.ID, product, amount)
+			order, err := orderService.CreateOrder("", user.ID, product, amount)
 			if err != nil {
 				log.Printf("Error creating order for user %s: %v", user.Name, err)
 				continue
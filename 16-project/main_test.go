@@ -0,0 +1,2995 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Eventually polls cond every interval and fails t if it hasn't returned
+// true within timeout
+func Eventually(t testing.TB, timeout, interval time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %v", timeout)
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+// recordingTB captures failures instead of failing the running test
+type recordingTB struct {
+	testing.TB
+	failed  bool
+	message string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Fatalf(format string, args ...any) {
+	r.failed = true
+	r.message = fmt.Sprintf(format, args...)
+}
+
+func TestEventuallyPassesOnceConditionHolds(t *testing.T) {
+	start := time.Now()
+	Eventually(t, time.Second, time.Millisecond, func() bool {
+		return time.Since(start) > 20*time.Millisecond
+	})
+}
+
+func TestEventuallyFailsWhenConditionNeverHolds(t *testing.T) {
+	t.Run("never true", func(t *testing.T) {
+		rec := &recordingTB{TB: t}
+		Eventually(rec, 20*time.Millisecond, time.Millisecond, func() bool { return false })
+		if !rec.failed {
+			t.Fatal("Eventually did not fail")
+		}
+		if rec.message != "condition not met within 20ms" {
+			t.Errorf("message = %q", rec.message)
+		}
+	})
+}
+
+// fixedRand is a RandSource that always returns the same values
+type fixedRand struct {
+	n int
+	f float64
+}
+
+func (r fixedRand) Intn(int) int     { return r.n }
+func (r fixedRand) Float64() float64 { return r.f }
+
+// newTestOrderService returns an order service whose simulated failures
+// never fire, shut down when the test ends
+func newTestOrderService(t *testing.T, broker *MessageBroker) *OrderService {
+	t.Helper()
+	os := NewOrderService(broker)
+	os.SetRandSource(fixedRand{f: 1})
+	t.Cleanup(func() { os.Shutdown(time.Second) })
+	return os
+}
+
+// === USERS ===
+
+func TestReadOnlyRejectsWritesAndServesReads(t *testing.T) {
+	us := NewUserService(NewMessageBroker())
+	us.SetFailureRate(0)
+	os := newTestOrderService(t, NewMessageBroker())
+	user, _ := us.CreateUser("Alice", "alice@example.com")
+	order, _ := os.CreateOrder("", user.ID, "Laptop", 999.99)
+
+	us.SetReadOnly(true)
+	os.SetReadOnly(true)
+
+	if _, err := us.CreateUser("Bob", "bob@example.com"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CreateUser: got %v, want ErrReadOnly", err)
+	}
+	if _, err := os.CreateOrder("", user.ID, "Mouse", 25); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("CreateOrder: got %v, want ErrReadOnly", err)
+	}
+	if _, err := us.GetUser(user.ID); err != nil {
+		t.Errorf("GetUser in read-only mode: %v", err)
+	}
+	if _, err := os.GetOrder(order.ID); err != nil {
+		t.Errorf("GetOrder in read-only mode: %v", err)
+	}
+
+	us.SetReadOnly(false)
+	os.SetReadOnly(false)
+
+	if _, err := us.CreateUser("Bob", "bob@example.com"); err != nil {
+		t.Errorf("CreateUser after read-only: %v", err)
+	}
+	if _, err := os.CreateOrder("", user.ID, "Mouse", 25); err != nil {
+		t.Errorf("CreateOrder after read-only: %v", err)
+	}
+}
+
+func TestCreateUserReturnsCopy(t *testing.T) {
+	us := NewUserService(NewMessageBroker())
+	us.SetFailureRate(0)
+
+	user, err := us.CreateUser("Alice", "alice@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user.Name = "Mallory"
+	user.Profile.Bio = "tampered"
+	user.Profile.Tags = append(user.Profile.Tags, "admin")
+
+	stored, err := us.GetUser(user.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if stored.Name != "Alice" {
+		t.Errorf("stored name = %q, want %q", stored.Name, "Alice")
+	}
+	if stored.Profile.Bio != "" || len(stored.Profile.Tags) != 0 {
+		t.Errorf("stored profile = %+v, want empty", *stored.Profile)
+	}
+}
+
+func TestGetUserReturnsCopyOfProfile(t *testing.T) {
+	us := NewUserService(NewMessageBroker())
+	us.SetFailureRate(0)
+	user, _ := us.CreateUser("Alice", "alice@example.com")
+
+	first, _ := us.GetUser(user.ID)
+	first.Profile.Bio = "tampered"
+
+	second, _ := us.GetUser(user.ID)
+	if second.Profile.Bio != "" {
+		t.Errorf("stored bio = %q, want empty", second.Profile.Bio)
+	}
+}
+
+func TestUserFailureRateOpensBreaker(t *testing.T) {
+	us := NewUserService(NewMessageBroker())
+	us.SetFailureRate(1)
+
+	for i := 0; i < us.breaker.maxFailures; i++ {
+		if _, err := us.CreateUser("Alice", "alice@example.com"); !errors.Is(err, ErrSimulatedFailure) {
+			t.Fatalf("attempt %d: got %v, want ErrSimulatedFailure", i+1, err)
+		}
+	}
+
+	if state := us.breaker.GetState(); state != Open {
+		t.Errorf("breaker state = %s, want open", state)
+	}
+	if _, err := us.CreateUser("Alice", "alice@example.com"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+}
+
+// === ORDERS ===
+
+func TestCreatedOrderIsProcessedInBackground(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+
+	order, err := os.CreateOrder("", 1, "Laptop", 999.99)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	Eventually(t, 2*time.Second, 5*time.Millisecond, func() bool {
+		stored, err := os.GetOrder(order.ID)
+		return err == nil && stored.Status == OrderCompleted
+	})
+}
+
+func TestCreateOrderReturnsCopy(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+
+	order, err := os.CreateOrder("", 1, "Laptop", 999.99)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	order.Product = "Tampered"
+
+	stored, err := os.GetOrder(order.ID)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if stored.Product != "Laptop" {
+		t.Errorf("stored product = %q, want %q", stored.Product, "Laptop")
+	}
+}
+
+func TestCreateOrderResultIsSafeToReadWhileProcessing(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+
+	order, err := os.CreateOrder("", 1, "Laptop", 999.99)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	// The worker moves the stored order on; run with -race to catch it
+	// writing to the value we were handed
+	Eventually(t, 2*time.Second, 5*time.Millisecond, func() bool {
+		if order.Status != OrderPending {
+			t.Fatalf("returned order changed to %q", order.Status)
+		}
+		stored, _ := os.GetOrder(order.ID)
+		return stored.Status == OrderCompleted
+	})
+}
+
+// addOrder stores an order in status directly, bypassing the worker
+func addOrder(os *OrderService, status OrderStatus) *Order {
+	os.mu.Lock()
+	defer os.mu.Unlock()
+	order := &Order{ID: len(os.orders) + 1, UserID: 1, Product: "Laptop", Amount: 10, Status: status}
+	os.orders[order.ID] = order
+	return order
+}
+
+func TestUpdateStatusCancelsPendingOrder(t *testing.T) {
+	broker := NewMessageBroker()
+	os := newTestOrderService(t, broker)
+	changes := make(chan Message, 1)
+	broker.Subscribe("order.status_changed", changes)
+	order := addOrder(os, OrderPending)
+
+	if err := os.UpdateStatus(order.ID, "cancelled"); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+
+	stored, _ := os.GetOrder(order.ID)
+	if stored.Status != OrderCancelled {
+		t.Errorf("status = %s, want cancelled", stored.Status)
+	}
+	select {
+	case msg := <-changes:
+		change := MustAs[OrderStatusChange](msg.Payload)
+		if change.From != OrderPending || change.To != OrderCancelled {
+			t.Errorf("event = %+v, want pending -> cancelled", change)
+		}
+	case <-time.After(time.Second):
+		t.Error("no order.status_changed event")
+	}
+}
+
+func TestUpdateStatusFollowsTransitionGraph(t *testing.T) {
+	t.Run("accepts processing -> completed", func(t *testing.T) {
+		os := newTestOrderService(t, NewMessageBroker())
+		order := addOrder(os, OrderProcessing)
+
+		if err := os.UpdateStatus(order.ID, "completed"); err != nil {
+			t.Fatalf("UpdateStatus: %v", err)
+		}
+		stored, _ := os.GetOrder(order.ID)
+		if stored.Status != OrderCompleted {
+			t.Errorf("status = %s, want completed", stored.Status)
+		}
+	})
+
+	t.Run("rejects pending -> completed", func(t *testing.T) {
+		os := newTestOrderService(t, NewMessageBroker())
+		order := addOrder(os, OrderPending)
+
+		err := os.UpdateStatus(order.ID, "completed")
+
+		var transitionErr *InvalidTransitionError
+		if !errors.As(err, &transitionErr) {
+			t.Fatalf("got %v, want *InvalidTransitionError", err)
+		}
+		if transitionErr.From != OrderPending || transitionErr.To != OrderCompleted {
+			t.Errorf("error = %+v, want pending -> completed", transitionErr)
+		}
+		stored, _ := os.GetOrder(order.ID)
+		if stored.Status != OrderPending {
+			t.Errorf("status = %s, want unchanged pending", stored.Status)
+		}
+	})
+}
+
+func TestOrderStatusCanTransitionTo(t *testing.T) {
+	all := []OrderStatus{OrderPending, OrderDegraded, OrderProcessing, OrderCompleted, OrderCancelled}
+	legal := map[[2]OrderStatus]bool{
+		{OrderPending, OrderDegraded}:     true,
+		{OrderPending, OrderProcessing}:   true,
+		{OrderPending, OrderCancelled}:    true,
+		{OrderDegraded, OrderPending}:     true,
+		{OrderDegraded, OrderCancelled}:   true,
+		{OrderProcessing, OrderCompleted}: true,
+	}
+
+	// Every pair not listed, including self-loops and anything out of a
+	// final status, must be refused
+	for _, from := range all {
+		for _, to := range all {
+			want := legal[[2]OrderStatus{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %t, want %t", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestParseOrderStatus(t *testing.T) {
+	for status, name := range orderStatusNames {
+		got, err := ParseOrderStatus(name)
+		if err != nil || got != status {
+			t.Errorf("ParseOrderStatus(%q) = %s, %v; want %s", name, got, err, status)
+		}
+		if status.String() != name {
+			t.Errorf("%d.String() = %q, want %q", int(status), status.String(), name)
+		}
+	}
+
+	for _, bad := range []string{"", "Pending", "shipped"} {
+		if _, err := ParseOrderStatus(bad); err == nil {
+			t.Errorf("ParseOrderStatus(%q) succeeded, want an error", bad)
+		}
+	}
+	if got := OrderStatus(99).String(); got != "OrderStatus(99)" {
+		t.Errorf("String of unknown status = %q", got)
+	}
+}
+
+func TestOrderStatusJSONRoundTrip(t *testing.T) {
+	for status, name := range orderStatusNames {
+		data, err := json.Marshal(Order{ID: 1, Status: status})
+		if err != nil {
+			t.Fatalf("marshal %s: %v", status, err)
+		}
+		if !strings.Contains(string(data), `"status":"`+name+`"`) {
+			t.Errorf("JSON %s, want status encoded as %q", data, name)
+		}
+
+		var decoded Order
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+		if decoded.Status != status {
+			t.Errorf("round-trip of %s gave %s", status, decoded.Status)
+		}
+	}
+}
+
+func TestOrderStatusJSONRejectsUnknown(t *testing.T) {
+	if _, err := json.Marshal(OrderStatus(99)); err == nil {
+		t.Error("marshaling an unknown status succeeded")
+	}
+	var status OrderStatus
+	if err := json.Unmarshal([]byte(`"shipped"`), &status); err == nil {
+		t.Error(`unmarshaling "shipped" succeeded`)
+	}
+	if err := json.Unmarshal([]byte(`2`), &status); err == nil {
+		t.Error("unmarshaling a bare number succeeded")
+	}
+}
+
+func TestUpdateStatusReadOnly(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	order := addOrder(os, OrderPending)
+	os.SetReadOnly(true)
+
+	if err := os.UpdateStatus(order.ID, "cancelled"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("got %v, want ErrReadOnly", err)
+	}
+
+	os.SetReadOnly(false)
+	if err := os.UpdateStatus(order.ID, "cancelled"); err != nil {
+		t.Errorf("after leaving read-only: %v", err)
+	}
+}
+
+func TestCreateOrderIdempotencyKey(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+
+	first, err := os.CreateOrder("key-1", 1, "Laptop", 999.99)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	retry, err := os.CreateOrder("key-1", 1, "Laptop", 999.99)
+	if err != nil {
+		t.Fatalf("CreateOrder retry: %v", err)
+	}
+	other, err := os.CreateOrder("key-2", 1, "Laptop", 999.99)
+	if err != nil {
+		t.Fatalf("CreateOrder with new key: %v", err)
+	}
+
+	if retry.ID != first.ID {
+		t.Errorf("retry created order %d, want %d", retry.ID, first.ID)
+	}
+	if other.ID == first.ID {
+		t.Error("a different key reused the first order")
+	}
+	if n := len(os.GetAll()); n != 2 {
+		t.Errorf("orders = %d, want 2", n)
+	}
+}
+
+func TestCreateOrderIdempotencyKeyExpires(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	os.SetIdempotencyTTL(10 * time.Millisecond)
+
+	first, _ := os.CreateOrder("key-1", 1, "Laptop", 999.99)
+	time.Sleep(20 * time.Millisecond)
+	again, err := os.CreateOrder("key-1", 1, "Laptop", 999.99)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+
+	if again.ID == first.ID {
+		t.Error("expired key still returned the first order")
+	}
+}
+
+// cancelAfterChecks is a context whose Err starts reporting
+// context.Canceled after it has been checked n times
+type cancelAfterChecks struct {
+	context.Context
+	n      int
+	checks int
+}
+
+func (c *cancelAfterChecks) Err() error {
+	c.checks++
+	if c.checks > c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCreateOrdersStopsWhenContextIsCancelled(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	reqs := []OrderRequest{
+		{UserID: 1, Product: "Laptop", Amount: 999},
+		{UserID: 1, Product: "Mouse", Amount: 25},
+		{UserID: 1, Product: "Keyboard", Amount: 75},
+		{UserID: 1, Product: "Monitor", Amount: 300},
+	}
+
+	// Cancelled right after the second order is created
+	ctx := &cancelAfterChecks{Context: context.Background(), n: 2}
+	orders, err := os.CreateOrders(ctx, reqs)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(orders) != 2 || orders[0].Product != "Laptop" || orders[1].Product != "Mouse" {
+		t.Errorf("orders = %+v, want the first two", orders)
+	}
+	if n := len(os.GetAll()); n != 2 {
+		t.Errorf("stored orders = %d, want 2", n)
+	}
+}
+
+func TestCreateOrdersWithCancelledContextCreatesNothing(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	orders, err := os.CreateOrders(ctx, []OrderRequest{{UserID: 1, Product: "Laptop", Amount: 999}})
+
+	if !errors.Is(err, context.Canceled) || len(orders) != 0 {
+		t.Errorf("got %d orders, %v; want none and context.Canceled", len(orders), err)
+	}
+}
+
+func TestCreateOrdersCreatesWholeBatch(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+
+	orders, err := os.CreateOrders(context.Background(), []OrderRequest{
+		{UserID: 1, Product: "Laptop", Amount: 999},
+		{UserID: 2, Product: "Mouse", Amount: 25},
+	})
+
+	if err != nil || len(orders) != 2 || orders[1].UserID != 2 {
+		t.Errorf("got %+v, %v; want both orders", orders, err)
+	}
+}
+
+// saturatePool occupies every worker and fills the queue up to the
+// Overloaded threshold with jobs that block until the returned func runs
+func saturatePool(t *testing.T, wp *WorkerPool) (release func()) {
+	t.Helper()
+	gate := make(chan struct{})
+	blocker := Job{Result: make(chan error, 1), Task: func() error {
+		<-gate
+		return nil
+	}}
+
+	for i := 0; i < wp.workers; i++ {
+		wp.Submit(blocker)
+	}
+	Eventually(t, time.Second, time.Millisecond, func() bool {
+		return wp.Stats().Active == int64(wp.workers)
+	})
+	for !wp.Overloaded() {
+		blocker.Result = make(chan error, 1)
+		wp.Submit(blocker)
+	}
+
+	var once sync.Once
+	release = func() { once.Do(func() { close(gate) }) }
+	t.Cleanup(release)
+	return release
+}
+
+func TestCreateOrderDegradesWhenPoolIsOverloaded(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	release := saturatePool(t, os.workerPool)
+
+	order, err := os.CreateOrder("", 1, "Laptop", 999)
+	if err != nil {
+		t.Fatalf("CreateOrder: %v", err)
+	}
+	if order.Status != OrderDegraded {
+		t.Fatalf("status = %v, want queued_degraded", order.Status)
+	}
+
+	// While the pool stays overloaded the reconciler leaves it alone
+	os.reconcileDegradedOrders()
+	if stored, _ := os.GetOrder(order.ID); stored.Status != OrderDegraded {
+		t.Fatalf("status after reconcile under load = %v, want queued_degraded", stored.Status)
+	}
+
+	release()
+	Eventually(t, 3*time.Second, 10*time.Millisecond, func() bool {
+		stored, _ := os.GetOrder(order.ID)
+		return stored.Status == OrderCompleted
+	})
+}
+
+func TestCancelledDegradedOrderIsNotReconciled(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	release := saturatePool(t, os.workerPool)
+	order, _ := os.CreateOrder("", 1, "Laptop", 999)
+
+	if err := os.UpdateStatus(order.ID, "cancelled"); err != nil {
+		t.Fatalf("cancel degraded order: %v", err)
+	}
+	release()
+	Eventually(t, time.Second, 5*time.Millisecond, func() bool {
+		return !os.workerPool.Overloaded()
+	})
+	os.reconcileDegradedOrders()
+
+	time.Sleep(150 * time.Millisecond)
+	if stored, _ := os.GetOrder(order.ID); stored.Status != OrderCancelled {
+		t.Errorf("status = %v, want cancelled", stored.Status)
+	}
+}
+
+// === WORKER POOL ===
+
+// newTestPool returns a started pool that is stopped when the test ends
+func newTestPool(t *testing.T, workers, queueSize int) *WorkerPool {
+	t.Helper()
+	wp := NewWorkerPool(workers, queueSize)
+	wp.Start()
+	t.Cleanup(wp.Stop)
+	return wp
+}
+
+func TestJobPastDeadlineIsSkipped(t *testing.T) {
+	wp := newTestPool(t, 1, 1)
+	var ran atomic.Bool
+	result := make(chan error, 1)
+
+	wp.Submit(Job{ID: "stale", Deadline: time.Now().Add(-time.Second), Result: result, Task: func() error {
+		ran.Store(true)
+		return nil
+	}})
+
+	if err := <-result; !errors.Is(err, ErrJobExpired) {
+		t.Errorf("result = %v, want ErrJobExpired", err)
+	}
+	if ran.Load() {
+		t.Error("expired job's task ran")
+	}
+}
+
+func TestJobBeforeDeadlineRuns(t *testing.T) {
+	wp := newTestPool(t, 1, 1)
+	result := make(chan error, 1)
+
+	wp.Submit(Job{ID: "fresh", Deadline: time.Now().Add(time.Minute), Result: result, Task: func() error { return nil }})
+
+	if err := <-result; err != nil {
+		t.Errorf("result = %v, want nil", err)
+	}
+}
+
+// flakyTask fails its first failures calls, then succeeds, recording when
+// each attempt started
+func flakyTask(failures int) (task func() error, attempts func() []time.Time) {
+	var (
+		mu    sync.Mutex
+		times []time.Time
+	)
+	task = func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, time.Now())
+		if len(times) <= failures {
+			return ErrSimulatedFailure
+		}
+		return nil
+	}
+	attempts = func() []time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Time(nil), times...)
+	}
+	return task, attempts
+}
+
+func TestRetriedJobSucceedsAfterFailures(t *testing.T) {
+	wp := newTestPool(t, 1, 1)
+	task, attempts := flakyTask(2)
+	result := make(chan error, 1)
+
+	wp.Submit(Job{ID: "flaky", Type: "flaky", Task: task, Result: result, MaxRetries: 3, Backoff: 10 * time.Millisecond})
+
+	if err := <-result; err != nil {
+		t.Fatalf("result = %v, want success on the third attempt", err)
+	}
+	times := attempts()
+	if len(times) != 3 {
+		t.Fatalf("ran %d times, want 3", len(times))
+	}
+	// Backoff doubles: 10ms before the first retry, 20ms before the second
+	if gap := times[1].Sub(times[0]); gap < 10*time.Millisecond {
+		t.Errorf("first retry after %v, want at least 10ms", gap)
+	}
+	if gap := times[2].Sub(times[1]); gap < 20*time.Millisecond {
+		t.Errorf("second retry after %v, want at least 20ms", gap)
+	}
+	if stats := wp.StatsByType()["flaky"]; stats.Failures != 2 || stats.Successes != 1 {
+		t.Errorf("stats = %+v, want every attempt counted", stats)
+	}
+}
+
+func TestRetriedJobReportsErrorWhenExhausted(t *testing.T) {
+	wp := newTestPool(t, 1, 1)
+	task, attempts := flakyTask(10)
+	result := make(chan error, 2)
+
+	wp.Submit(Job{ID: "doomed", Task: task, Result: result, MaxRetries: 2, Backoff: time.Millisecond})
+
+	if err := <-result; !errors.Is(err, ErrSimulatedFailure) {
+		t.Errorf("result = %v, want the task's last error", err)
+	}
+	if n := len(attempts()); n != 3 {
+		t.Errorf("ran %d times, want 1 attempt plus 2 retries", n)
+	}
+	select {
+	case err := <-result:
+		t.Errorf("second result %v, want exactly one", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestRetryBackoffDoesNotHoldWorker(t *testing.T) {
+	wp := newTestPool(t, 1, 2)
+	task, attempts := flakyTask(1)
+	slowResult, quickResult := make(chan error, 1), make(chan error, 1)
+
+	wp.Submit(Job{ID: "backing-off", Task: task, Result: slowResult, MaxRetries: 1, Backoff: 200 * time.Millisecond})
+	Eventually(t, time.Second, time.Millisecond, func() bool { return len(attempts()) > 0 })
+
+	// The only worker must be free while the first job waits to retry
+	start := time.Now()
+	wp.Submit(Job{ID: "quick", Task: func() error { return nil }, Result: quickResult})
+	if err := <-quickResult; err != nil {
+		t.Fatalf("quick job: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("quick job took %v, want it to run during the other job's backoff", elapsed)
+	}
+	if err := <-slowResult; err != nil {
+		t.Errorf("retried job: %v", err)
+	}
+}
+
+func TestStopDuringBackoffReportsLastError(t *testing.T) {
+	wp := NewWorkerPool(1, 1)
+	wp.Start()
+	task, attempts := flakyTask(10)
+	result := make(chan error, 1)
+
+	wp.Submit(Job{ID: "interrupted", Task: task, Result: result, MaxRetries: 5, Backoff: 30 * time.Millisecond})
+	Eventually(t, time.Second, time.Millisecond, func() bool { return len(attempts()) > 0 })
+	wp.Stop()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrSimulatedFailure) {
+			t.Errorf("result = %v, want the failed attempt's error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no result after the pool stopped mid-backoff")
+	}
+	if n := len(attempts()); n != 1 {
+		t.Errorf("ran %d times, want no retry after Stop", n)
+	}
+}
+
+// blockPool occupies wp's only worker and fills its queue of size 1, so
+// the next submission blocks. Close the returned channel to drain it.
+func blockPool(t *testing.T, wp *WorkerPool) chan struct{} {
+	t.Helper()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	wp.Submit(Job{ID: "busy", Result: make(chan error, 1), Task: func() error {
+		close(started)
+		<-release
+		return nil
+	}})
+	<-started
+
+	// One job waits in the dispatcher for a free worker, one in the queue
+	wp.Submit(Job{ID: "waiting", Result: make(chan error, 1), Task: func() error { return nil }})
+	Eventually(t, time.Second, time.Millisecond, func() bool { return wp.Stats().Queued == 0 })
+	wp.Submit(Job{ID: "queued", Result: make(chan error, 1), Task: func() error { return nil }})
+	return release
+}
+
+func TestSubmitWithCancelledContextNeverRuns(t *testing.T) {
+	wp := newTestPool(t, 1, 1)
+	var ran atomic.Bool
+	result := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := wp.SubmitWithContext(ctx, Job{ID: "cancelled", Result: result, Task: func() error {
+		ran.Store(true)
+		return nil
+	}})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SubmitWithContext = %v, want context.Canceled", err)
+	}
+	select {
+	case err := <-result:
+		t.Errorf("got result %v for a job that was never accepted", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if ran.Load() {
+		t.Error("task ran despite the cancelled context")
+	}
+}
+
+func TestSubmitWithContextGivesUpWhileQueueIsFull(t *testing.T) {
+	wp := newTestPool(t, 1, 1)
+	release := blockPool(t, wp)
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var ran atomic.Bool
+	start := time.Now()
+
+	err := wp.SubmitWithContext(ctx, Job{ID: "late", Result: make(chan error, 1), Task: func() error {
+		ran.Store(true)
+		return nil
+	}})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SubmitWithContext = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("blocked for %v, want it to return at the 20ms deadline", elapsed)
+	}
+	if ran.Load() {
+		t.Error("rejected job ran")
+	}
+}
+
+func TestJobCancelledWhileQueuedIsSkipped(t *testing.T) {
+	wp := newTestPool(t, 1, 2)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	wp.Submit(Job{ID: "busy", Result: make(chan error, 1), Task: func() error {
+		close(started)
+		<-release
+		return nil
+	}})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran atomic.Bool
+	result := make(chan error, 1)
+	if err := wp.SubmitWithContext(ctx, Job{ID: "abandoned", Result: result, Task: func() error {
+		ran.Store(true)
+		return nil
+	}}); err != nil {
+		t.Fatalf("SubmitWithContext: %v", err)
+	}
+
+	// The caller gives up before a worker is free
+	cancel()
+	close(release)
+
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Errorf("result = %v, want context.Canceled", err)
+	}
+	if ran.Load() {
+		t.Error("task of a cancelled job ran")
+	}
+}
+
+func TestPoolStatsTrackActiveAndQueuedJobs(t *testing.T) {
+	wp := newTestPool(t, 2, 5)
+	if got := wp.Stats(); got != (PoolStats{Workers: 2}) {
+		t.Fatalf("idle stats = %+v, want only the worker count", got)
+	}
+
+	release := make(chan struct{})
+	results := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wp.Submit(Job{ID: fmt.Sprintf("job-%d", i), Result: results, Task: func() error {
+			<-release
+			return nil
+		}})
+	}
+
+	// Two jobs run, one waits in the dispatcher, two stay queued
+	Eventually(t, time.Second, time.Millisecond, func() bool {
+		return wp.Stats() == PoolStats{Queued: 2, Workers: 2, Active: 2}
+	})
+
+	close(release)
+	for i := 0; i < 5; i++ {
+		<-results
+	}
+	Eventually(t, time.Second, time.Millisecond, func() bool {
+		return wp.Stats() == PoolStats{Workers: 2}
+	})
+}
+
+func TestStatsByTypeAggregatesPerType(t *testing.T) {
+	wp := newTestPool(t, 2, 10)
+
+	run := func(jobType string, d time.Duration, err error) {
+		result := make(chan error, 1)
+		wp.Submit(Job{ID: jobType, Type: jobType, Result: result, Task: func() error {
+			time.Sleep(d)
+			return err
+		}})
+		<-result
+	}
+	run("user", 10*time.Millisecond, nil)
+	run("user", 10*time.Millisecond, nil)
+	run("order", 30*time.Millisecond, nil)
+	run("order", 30*time.Millisecond, ErrSimulatedFailure)
+	run("order", 30*time.Millisecond, ErrSimulatedFailure)
+	run("", 0, nil)
+
+	stats := wp.StatsByType()
+	user, order := stats["user"], stats["order"]
+	if user.Count != 2 || user.Successes != 2 || user.Failures != 0 {
+		t.Errorf("user stats = %+v, want 2 successes", user)
+	}
+	if order.Count != 3 || order.Successes != 1 || order.Failures != 2 {
+		t.Errorf("order stats = %+v, want 1 success and 2 failures", order)
+	}
+	if user.AverageDuration < 10*time.Millisecond || order.AverageDuration < 30*time.Millisecond {
+		t.Errorf("averages user %v, order %v; want at least 10ms and 30ms", user.AverageDuration, order.AverageDuration)
+	}
+	if user.AverageDuration >= order.AverageDuration {
+		t.Errorf("user average %v should be below order average %v", user.AverageDuration, order.AverageDuration)
+	}
+	if stats["untyped"].Count != 1 {
+		t.Errorf("untyped count = %d, want jobs without a Type grouped as untyped", stats["untyped"].Count)
+	}
+}
+
+func TestStatsByTypeReturnsSnapshot(t *testing.T) {
+	wp := newTestPool(t, 1, 1)
+	result := make(chan error, 1)
+	wp.Submit(Job{Type: "user", Result: result, Task: func() error { return nil }})
+	<-result
+
+	snapshot := wp.StatsByType()
+	snapshot["user"] = JobStats{Count: 100}
+	if wp.StatsByType()["user"].Count != 1 {
+		t.Error("mutating the snapshot changed the pool's stats")
+	}
+}
+
+func TestStopWithTimeoutWaitsForRunningJobs(t *testing.T) {
+	wp := NewWorkerPool(1, 1)
+	wp.Start()
+	started := make(chan struct{})
+	var finished atomic.Bool
+	wp.Submit(Job{ID: "quick", Result: make(chan error, 1), Task: func() error {
+		close(started)
+		time.Sleep(20 * time.Millisecond)
+		finished.Store(true)
+		return nil
+	}})
+	<-started
+
+	if err := wp.StopWithTimeout(time.Second); err != nil {
+		t.Fatalf("StopWithTimeout: %v", err)
+	}
+	if !finished.Load() {
+		t.Error("StopWithTimeout returned before the running job finished")
+	}
+}
+
+func TestStopWithTimeoutGivesUpOnStuckWorker(t *testing.T) {
+	wp := NewWorkerPool(1, 1)
+	wp.Start()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	wp.Submit(Job{ID: "stuck", Result: make(chan error, 1), Task: func() error {
+		close(started)
+		<-release
+		return nil
+	}})
+	<-started
+
+	start := time.Now()
+	err := wp.StopWithTimeout(20 * time.Millisecond)
+
+	if !errors.Is(err, ErrShutdownTimeout) {
+		t.Errorf("got %v, want ErrShutdownTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("StopWithTimeout took %v, want about 20ms", elapsed)
+	}
+}
+
+// === MESSAGING ===
+
+func TestSerializeModeIsolatesPayloads(t *testing.T) {
+	broker := NewMessageBroker()
+	broker.SetSerializePayloads(true)
+	first, second := make(chan Message, 1), make(chan Message, 1)
+	broker.Subscribe("user.created", first)
+	broker.Subscribe("user.created", second)
+
+	user := &User{ID: 1, Name: "Alice", Profile: &Profile{Tags: []string{"admin"}}}
+	broker.Publish("user.created", user)
+	// The publisher keeps using its object after publishing
+	user.Name = "Mallory"
+	user.Profile.Tags[0] = "root"
+
+	a, err := DecodePayload[*User](<-first)
+	if err != nil {
+		t.Fatalf("DecodePayload: %v", err)
+	}
+	if a.Name != "Alice" || a.Profile.Tags[0] != "admin" {
+		t.Errorf("subscriber saw %+v %v, want the value at publish time", a, a.Profile.Tags)
+	}
+
+	// Each subscriber decodes its own copy
+	a.Name = "Changed by first"
+	b, _ := DecodePayload[*User](<-second)
+	if b.Name != "Alice" {
+		t.Errorf("second subscriber saw %q, want Alice", b.Name)
+	}
+}
+
+func TestSharedPayloadWithoutSerializeMode(t *testing.T) {
+	broker := NewMessageBroker()
+	ch := make(chan Message, 1)
+	broker.Subscribe("user.created", ch)
+
+	user := &User{ID: 1, Name: "Alice"}
+	broker.Publish("user.created", user)
+	msg := <-ch
+
+	if msg.Data != nil {
+		t.Errorf("Data = %s, want nil when not serializing", msg.Data)
+	}
+	got, err := DecodePayload[*User](msg)
+	if err != nil || got != user {
+		t.Errorf("DecodePayload = %p, %v; want the published pointer", got, err)
+	}
+}
+
+func TestDecodePayloadTypeMismatch(t *testing.T) {
+	for _, serialize := range []bool{false, true} {
+		broker := NewMessageBroker()
+		broker.SetSerializePayloads(serialize)
+		ch := make(chan Message, 1)
+		broker.Subscribe("order.created", ch)
+		broker.Publish("order.created", "not an order")
+
+		if _, err := DecodePayload[*Order](<-ch); err == nil || !strings.Contains(err.Error(), "order.created") {
+			t.Errorf("serialize=%t: err = %v, want a decode error naming the topic", serialize, err)
+		}
+	}
+}
+
+func TestSerializeModeDropsUnencodablePayload(t *testing.T) {
+	broker := NewMessageBroker()
+	broker.SetSerializePayloads(true)
+	ch := make(chan Message, 1)
+	broker.Subscribe("topic", ch)
+
+	broker.Publish("topic", func() {})
+
+	if len(ch) != 0 {
+		t.Error("a payload that can't be encoded was delivered")
+	}
+}
+
+func TestPublishSurvivesConsumerClosingItsChannel(t *testing.T) {
+	broker := NewMessageBroker()
+	closed := make(chan Message, 1)
+	live := make(chan Message, 2)
+	broker.Subscribe("topic", closed)
+	broker.Subscribe("topic", live)
+
+	close(closed)
+	broker.Publish("topic", 1)
+	broker.Publish("topic", 2)
+
+	if len(live) != 2 {
+		t.Errorf("live subscriber got %d messages, want 2", len(live))
+	}
+	broker.mu.RLock()
+	remaining := len(broker.subscribers["topic"])
+	broker.mu.RUnlock()
+	if remaining != 1 {
+		t.Errorf("subscribers = %d, want the closed channel removed", remaining)
+	}
+	if dropped := broker.DroppedCount("topic"); dropped != 0 {
+		t.Errorf("dropped = %d, want 0", dropped)
+	}
+}
+
+func TestPublishAfterUnsubscribeAndClose(t *testing.T) {
+	broker := NewMessageBroker()
+	ch := make(chan Message, 1)
+	sub := broker.Subscribe("topic", ch)
+
+	sub.Unsubscribe()
+	close(ch)
+	broker.Publish("topic", "hello")
+
+	if dropped := broker.DroppedCount("topic"); dropped != 0 {
+		t.Errorf("dropped = %d, want 0", dropped)
+	}
+}
+
+func TestPublishCountsDropsForFullSubscribers(t *testing.T) {
+	broker := NewMessageBroker()
+	ch := make(chan Message, 1)
+	broker.Subscribe("topic", ch)
+
+	broker.Publish("topic", 1)
+	broker.Publish("topic", 2)
+
+	if dropped := broker.DroppedCount("topic"); dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+	if msg := <-ch; msg.Payload != 1 {
+		t.Errorf("delivered %v, want the first message", msg.Payload)
+	}
+}
+
+func TestAsSucceedsOnMatchingType(t *testing.T) {
+	if n, ok := As[int](42); !ok || n != 42 {
+		t.Errorf("As[int](42) = %d, %t; want 42, true", n, ok)
+	}
+	user := &User{ID: 1}
+	if got, ok := As[*User](user); !ok || got != user {
+		t.Errorf("As[*User] = %p, %t; want the same pointer", got, ok)
+	}
+	// Interface targets match anything implementing them
+	if err, ok := As[error](ErrNotFound); !ok || err != ErrNotFound {
+		t.Errorf("As[error] = %v, %t; want ErrNotFound, true", err, ok)
+	}
+}
+
+func TestAsMismatchReturnsZeroValue(t *testing.T) {
+	if n, ok := As[int]("42"); ok || n != 0 {
+		t.Errorf(`As[int]("42") = %d, %t; want 0, false`, n, ok)
+	}
+	if u, ok := As[*User](Order{}); ok || u != nil {
+		t.Errorf("As[*User](Order{}) = %v, %t; want nil, false", u, ok)
+	}
+	if s, ok := As[string](nil); ok || s != "" {
+		t.Errorf("As[string](nil) = %q, %t; want \"\", false", s, ok)
+	}
+}
+
+func TestMustAsPanicsOnMismatch(t *testing.T) {
+	if got := MustAs[string]("ok"); got != "ok" {
+		t.Errorf("MustAs[string] = %q, want ok", got)
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("MustAs did not panic")
+		}
+		if msg := fmt.Sprint(r); !strings.Contains(msg, "int") || !strings.Contains(msg, "*main.User") {
+			t.Errorf("panic %q, want it to name both types", msg)
+		}
+	}()
+	MustAs[*User](7)
+}
+
+func TestDecodeJSONNumbersKeepsIntegersAsInt64(t *testing.T) {
+	v, err := DecodeJSONNumbers([]byte(`{"id": 42, "amount": 9.99, "tags": [1, 2.5], "owner": {"id": 7}}`))
+	if err != nil {
+		t.Fatalf("DecodeJSONNumbers: %v", err)
+	}
+	payload := v.(map[string]interface{})
+
+	if id, ok := payload["id"].(int64); !ok || id != 42 {
+		t.Errorf("id = %#v, want int64(42)", payload["id"])
+	}
+	if amount, ok := payload["amount"].(float64); !ok || amount != 9.99 {
+		t.Errorf("amount = %#v, want float64(9.99)", payload["amount"])
+	}
+	if want := []interface{}{int64(1), 2.5}; !reflect.DeepEqual(payload["tags"], want) {
+		t.Errorf("tags = %#v, want %#v", payload["tags"], want)
+	}
+	if owner := payload["owner"].(map[string]interface{}); owner["id"] != int64(7) {
+		t.Errorf("owner.id = %#v, want int64(7)", owner["id"])
+	}
+}
+
+func TestDecodeJSONNumbersEdgeCases(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{`0`, int64(0)},
+		{`-17`, int64(-17)},
+		{`1.0`, 1.0},    // written as a float, so stays one
+		{`1e3`, 1000.0}, // exponent form isn't an integer literal
+		{`9223372036854775807`, int64(9223372036854775807)},
+		{`9223372036854775808`, 9223372036854775808.0}, // overflows int64
+		{`"42"`, "42"},
+	}
+
+	for _, tt := range tests {
+		got, err := DecodeJSONNumbers([]byte(tt.in))
+		if err != nil || got != tt.want {
+			t.Errorf("DecodeJSONNumbers(%s) = %#v, %v; want %#v", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := DecodeJSONNumbers([]byte(`{"id":`)); err == nil {
+		t.Error("truncated JSON decoded without error")
+	}
+}
+
+func TestSerializedMapPayloadKeepsIntegerIDs(t *testing.T) {
+	broker := NewMessageBroker()
+	broker.SetSerializePayloads(true)
+	ch := make(chan Message, 1)
+	broker.Subscribe("order.created", ch)
+	broker.Publish("order.created", map[string]interface{}{"order_id": 12})
+
+	payload, err := DecodePayload[map[string]interface{}](<-ch)
+	if err != nil {
+		t.Fatalf("DecodePayload: %v", err)
+	}
+	if id, ok := payload["order_id"].(int64); !ok || id != 12 {
+		t.Errorf("order_id = %#v, want int64(12)", payload["order_id"])
+	}
+}
+
+// subscriberCount reports how many channels are subscribed to topic
+func subscriberCount(broker *MessageBroker, topic string) int {
+	broker.mu.RLock()
+	defer broker.mu.RUnlock()
+	return len(broker.subscribers[topic])
+}
+
+// receive reads one value from ch or fails the test after a second
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed")
+		}
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("nothing received")
+	}
+	panic("unreachable")
+}
+
+func TestTypedBrokerDeliversTypedValues(t *testing.T) {
+	broker := NewMessageBroker()
+	changes := NewTypedBroker[OrderStatusChange](broker, "order.status_changed")
+	first, cancelFirst := changes.Subscribe()
+	defer cancelFirst()
+	second, cancelSecond := changes.Subscribe()
+	defer cancelSecond()
+
+	sent := []OrderStatusChange{
+		{OrderID: 1, From: OrderPending, To: OrderProcessing},
+		{OrderID: 1, From: OrderProcessing, To: OrderCompleted},
+	}
+	for _, change := range sent {
+		changes.Publish(change)
+	}
+
+	for _, sub := range []<-chan OrderStatusChange{first, second} {
+		for _, want := range sent {
+			if got := receive(t, sub); got != want {
+				t.Errorf("received %+v, want %+v", got, want)
+			}
+		}
+	}
+}
+
+func TestTypedBrokerSkipsPayloadsOfOtherTypes(t *testing.T) {
+	broker := NewMessageBroker()
+	changes := NewTypedBroker[OrderStatusChange](broker, "order.status_changed")
+	sub, cancel := changes.Subscribe()
+	defer cancel()
+
+	// Someone publishes the wrong type on the raw broker
+	broker.Publish("order.status_changed", "not a change")
+	want := OrderStatusChange{OrderID: 2, From: OrderPending, To: OrderCancelled}
+	changes.Publish(want)
+
+	if got := receive(t, sub); got != want {
+		t.Errorf("received %+v, want %+v", got, want)
+	}
+}
+
+func TestTypedBrokerCancelUnsubscribesAndCloses(t *testing.T) {
+	broker := NewMessageBroker()
+	changes := NewTypedBroker[int](broker, "numbers")
+	sub, cancel := changes.Subscribe()
+	if n := subscriberCount(broker, "numbers"); n != 1 {
+		t.Fatalf("subscribers = %d, want 1", n)
+	}
+
+	cancel()
+	cancel() // safe to call twice
+
+	if n := subscriberCount(broker, "numbers"); n != 0 {
+		t.Errorf("subscribers after cancel = %d, want 0", n)
+	}
+	select {
+	case _, ok := <-sub:
+		if ok {
+			t.Error("received a value after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Error("channel not closed after cancel")
+	}
+
+	changes.Publish(1) // must not block or panic with nobody listening
+}
+
+func TestUnsubscribeRemovesOnlyThatChannel(t *testing.T) {
+	broker := NewMessageBroker()
+	kept, removed := make(chan Message, 1), make(chan Message, 1)
+	broker.Subscribe("topic", kept)
+	broker.Subscribe("topic", removed)
+
+	broker.Unsubscribe("topic", removed)
+	broker.Unsubscribe("topic", make(chan Message)) // never subscribed: no-op
+	broker.Publish("topic", "hello")
+
+	if len(kept) != 1 || len(removed) != 0 {
+		t.Errorf("kept got %d, removed got %d; want 1 and 0", len(kept), len(removed))
+	}
+	if n := subscriberCount(broker, "topic"); n != 1 {
+		t.Errorf("subscribers = %d, want 1", n)
+	}
+}
+
+// === NOTIFICATIONS ===
+
+// mustNotificationService creates a notification service, failing the
+// test on invalid rules
+func mustNotificationService(t *testing.T, broker *MessageBroker, maxNotifications int, rules NotificationRules) *NotificationService {
+	t.Helper()
+	ns, err := NewNotificationService(broker, maxNotifications, rules)
+	if err != nil {
+		t.Fatalf("NewNotificationService: %v", err)
+	}
+	return ns
+}
+
+// newTestNotificationService returns a notification service whose sends
+// always succeed, stopped when the test ends
+func newTestNotificationService(t *testing.T, broker *MessageBroker, rules NotificationRules) *NotificationService {
+	t.Helper()
+	ns := mustNotificationService(t, broker, 100, rules)
+	ns.SetSender(func(*Notification) error { return nil })
+	t.Cleanup(ns.Stop)
+	return ns
+}
+
+// notificationTypes returns the channel of every stored notification,
+// newest first
+func notificationTypes(ns *NotificationService) []string {
+	var types []string
+	for _, n := range ns.ListRecent(100) {
+		types = append(types, n.Type)
+	}
+	return types
+}
+
+func TestNotificationRulesCreateOnePerChannel(t *testing.T) {
+	broker := NewMessageBroker()
+	ns := newTestNotificationService(t, broker, NotificationRules{"order.completed": {"email", "push"}})
+
+	broker.Publish("order.completed", &Order{ID: 1, UserID: 7, Product: "Laptop"})
+
+	Eventually(t, time.Second, 5*time.Millisecond, func() bool {
+		return len(ns.ListRecent(100)) == 2
+	})
+	types := notificationTypes(ns)
+	if !((types[0] == "email" && types[1] == "push") || (types[0] == "push" && types[1] == "email")) {
+		t.Errorf("types = %v, want email and push", types)
+	}
+}
+
+func TestNotificationRulesRejectUnknownTopic(t *testing.T) {
+	broker := NewMessageBroker()
+	_, err := NewNotificationService(broker, 100, NotificationRules{
+		"order.created":  {"email"},
+		"order.refunded": {"email"},
+	})
+	if !errors.Is(err, ErrUnknownTopic) || !strings.Contains(err.Error(), "order.refunded") {
+		t.Fatalf("err = %v, want ErrUnknownTopic naming order.refunded", err)
+	}
+	if n := len(broker.subscribers["order.created"]); n != 0 {
+		t.Errorf("rejected service left %d subscriptions behind", n)
+	}
+}
+
+func TestDefaultNotificationRulesAreAllHandled(t *testing.T) {
+	for topic := range DefaultNotificationRules {
+		if !notificationTopics[topic] {
+			t.Errorf("default rule for %q has no notification", topic)
+		}
+	}
+}
+
+func TestCancelledOrderSendsFailureNotification(t *testing.T) {
+	broker := NewMessageBroker()
+	ns := newTestNotificationService(t, broker, DefaultNotificationRules)
+	os := newTestOrderService(t, broker)
+	order := addOrder(os, OrderPending)
+
+	if err := os.UpdateStatus(order.ID, "cancelled"); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+
+	Eventually(t, time.Second, 5*time.Millisecond, func() bool {
+		types := notificationTypes(ns)
+		return len(types) == 1 && types[0] == "sms"
+	})
+}
+
+// deadLetter returns the dead-letter copy of notification id, if listed
+func deadLetter(ns *NotificationService, id int) (*Notification, bool) {
+	for _, n := range ns.DeadLetters() {
+		if n.ID == id {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func TestDefaultSenderUsesInjectedRandSource(t *testing.T) {
+	broker := NewMessageBroker()
+	ns := mustNotificationService(t, broker, 100, NotificationRules{"user.created": {"email"}})
+	ns.SetRandSource(fixedRand{f: 0}) // every simulated send fails
+	t.Cleanup(ns.Stop)
+
+	broker.Publish("user.created", &User{ID: 1, Name: "Alice"})
+
+	Eventually(t, time.Second, 5*time.Millisecond, func() bool {
+		_, listed := deadLetter(ns, 1)
+		return listed
+	})
+}
+
+func TestNotificationGivesUpAfterMaxAttempts(t *testing.T) {
+	broker := NewMessageBroker()
+	ns := newTestNotificationService(t, broker, NotificationRules{"user.created": {"email"}})
+	ns.SetSender(func(*Notification) error { return ErrSimulatedFailure })
+
+	broker.Publish("user.created", &User{ID: 1, Name: "Alice"})
+
+	Eventually(t, 3*time.Second, 10*time.Millisecond, func() bool {
+		n, listed := deadLetter(ns, 1)
+		return listed && n.Attempts == maxDeliveryAttempts
+	})
+	ns.mu.RLock()
+	pending := len(ns.retries)
+	ns.mu.RUnlock()
+	if pending != 0 {
+		t.Errorf("%d retries still scheduled after giving up", pending)
+	}
+}
+
+func TestRetriesDoNotWaitForEachOther(t *testing.T) {
+	broker := NewMessageBroker()
+	ns := newTestNotificationService(t, broker, NotificationRules{"user.created": {"email"}})
+
+	var mu sync.Mutex
+	calls := make(map[int]int)
+	ns.SetSender(func(n *Notification) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[n.ID]++
+		// Notification 1 never gets through; 2 only fails its first try
+		if n.ID == 1 || calls[n.ID] == 1 {
+			return ErrSimulatedFailure
+		}
+		return nil
+	})
+
+	broker.Publish("user.created", &User{ID: 1, Name: "Alice"})
+	// After its third failure notification 1 waits 4x the base backoff
+	Eventually(t, 2*time.Second, 5*time.Millisecond, func() bool {
+		n, _ := deadLetter(ns, 1)
+		return n != nil && n.Attempts == 3
+	})
+
+	broker.Publish("user.created", &User{ID: 2, Name: "Bob"})
+	Eventually(t, 2*deadLetterBackoff+deadLetterBackoff/2, 5*time.Millisecond, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		_, listed := deadLetter(ns, 2)
+		return calls[2] == 2 && !listed
+	})
+}
+
+func TestRetryBackoffDoublesAfterEachFailure(t *testing.T) {
+	ns := newTestNotificationService(t, NewMessageBroker(), NotificationRules{})
+
+	var mu sync.Mutex
+	var sends []time.Time
+	ns.SetSender(func(*Notification) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sends = append(sends, time.Now())
+		return ErrSimulatedFailure
+	})
+
+	ns.createNotification(1, "email", "hello")
+	Eventually(t, 3*time.Second, 5*time.Millisecond, func() bool {
+		n, _ := deadLetter(ns, 1)
+		return n != nil && n.Attempts == maxDeliveryAttempts
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sends) != maxDeliveryAttempts {
+		t.Fatalf("sender called %d times, want %d", len(sends), maxDeliveryAttempts)
+	}
+	// 200ms, 400ms, 800ms; allow for timer and scheduling slack
+	for i := 1; i < len(sends); i++ {
+		want := deadLetterBackoff << (i - 1)
+		gap := sends[i].Sub(sends[i-1])
+		if gap < want || gap > want+deadLetterBackoff/2 {
+			t.Errorf("wait before attempt %d = %v, want about %v", i+1, gap, want)
+		}
+	}
+}
+
+func TestDeadLettersAreCapped(t *testing.T) {
+	ns := newTestNotificationService(t, NewMessageBroker(), nil)
+
+	ns.mu.Lock()
+	for id := 1; id <= maxDeadLetters+1; id++ {
+		ns.addDeadLetter(&Notification{ID: id, Attempts: maxDeliveryAttempts})
+	}
+	ns.mu.Unlock()
+
+	letters := ns.DeadLetters()
+	if len(letters) != maxDeadLetters {
+		t.Fatalf("dead letters = %d, want %d", len(letters), maxDeadLetters)
+	}
+	if letters[0].ID != 2 {
+		t.Errorf("oldest remaining = %d, want 2", letters[0].ID)
+	}
+}
+
+func TestNotificationStoreEvictsOldest(t *testing.T) {
+	ns := mustNotificationService(t, NewMessageBroker(), 3, NotificationRules{})
+	ns.SetSender(func(*Notification) error { return nil })
+	t.Cleanup(ns.Stop)
+
+	for i := 1; i <= 5; i++ {
+		ns.createNotification(1, "email", fmt.Sprintf("message %d", i))
+	}
+
+	recent := ns.ListRecent(10)
+	var ids []int
+	for _, n := range recent {
+		ids = append(ids, n.ID)
+	}
+	if fmt.Sprint(ids) != "[5 4 3]" {
+		t.Errorf("ids = %v, want [5 4 3]", ids)
+	}
+
+	// Ids keep counting up after eviction instead of reusing freed slots
+	ns.createNotification(1, "email", "message 6")
+	if newest := ns.ListRecent(1); newest[0].ID != 6 {
+		t.Errorf("next id = %d, want 6", newest[0].ID)
+	}
+}
+
+func TestListRecentReturnsCopies(t *testing.T) {
+	ns := mustNotificationService(t, NewMessageBroker(), 3, NotificationRules{})
+	ns.SetSender(func(*Notification) error { return nil })
+	t.Cleanup(ns.Stop)
+	ns.createNotification(1, "email", "hello")
+
+	ns.ListRecent(1)[0].Message = "tampered"
+
+	if got := ns.ListRecent(1)[0].Message; got != "hello" {
+		t.Errorf("stored message = %q, want %q", got, "hello")
+	}
+}
+
+func TestStopCancelsPendingRetries(t *testing.T) {
+	ns := mustNotificationService(t, NewMessageBroker(), 10, NotificationRules{})
+	var calls atomic.Int32
+	ns.SetSender(func(*Notification) error {
+		calls.Add(1)
+		return errors.New("smtp down")
+	})
+
+	ns.createNotification(1, "email", "hello")
+	Eventually(t, time.Second, 5*time.Millisecond, func() bool {
+		ns.mu.Lock()
+		defer ns.mu.Unlock()
+		return len(ns.retries) == 1
+	})
+
+	ns.Stop()
+
+	ns.mu.Lock()
+	pending := len(ns.retries)
+	ns.mu.Unlock()
+	if pending != 0 {
+		t.Errorf("retries = %d after Stop, want 0", pending)
+	}
+	time.Sleep(deadLetterBackoff + deadLetterBackoff/2)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("sender called %d times, want no retry after Stop", n)
+	}
+}
+
+func TestStopWaitsForInFlightSends(t *testing.T) {
+	ns := mustNotificationService(t, NewMessageBroker(), 10, NotificationRules{})
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	ns.SetSender(func(*Notification) error {
+		close(sending)
+		<-release
+		return nil
+	})
+
+	ns.createNotification(1, "email", "hello")
+	<-sending
+
+	stopped := make(chan struct{})
+	go func() {
+		ns.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned while a send was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return after the send finished")
+	}
+	if !ns.ListRecent(1)[0].Sent {
+		t.Error("in-flight notification was not marked sent")
+	}
+}
+
+// === OBSERVABLE ===
+
+func TestObservableWatchReceivesUpdates(t *testing.T) {
+	o := NewObservable(0)
+	ch, cancel := o.Watch()
+	defer cancel()
+
+	if v := <-ch; v != 0 {
+		t.Fatalf("first value = %d, want the current value 0", v)
+	}
+	for _, want := range []int{1, 2, 3} {
+		o.Set(want)
+		if v := <-ch; v != want {
+			t.Errorf("got %d, want %d", v, want)
+		}
+	}
+	if o.Get() != 3 {
+		t.Errorf("Get = %d, want 3", o.Get())
+	}
+}
+
+func TestObservableSlowWatcherSeesLatestValue(t *testing.T) {
+	o := NewObservable("closed")
+	ch, cancel := o.Watch()
+	defer cancel()
+
+	// None of these may block even though nobody is reading
+	o.Set("open")
+	o.Set("half-open")
+	o.Set("closed")
+
+	if v := <-ch; v != "closed" {
+		t.Errorf("got %q, want the latest value", v)
+	}
+	select {
+	case v := <-ch:
+		t.Errorf("unexpected extra value %q", v)
+	default:
+	}
+}
+
+func TestObservableCancelStopsWatching(t *testing.T) {
+	o := NewObservable(0)
+	ch, cancel := o.Watch()
+	<-ch
+
+	cancel()
+	cancel() // safe to call twice
+	o.Set(1)
+
+	if _, ok := <-ch; ok {
+		t.Error("channel still open after cancel")
+	}
+	o.mu.RLock()
+	watchers := len(o.watchers)
+	o.mu.RUnlock()
+	if watchers != 0 {
+		t.Errorf("watchers = %d after cancel, want 0", watchers)
+	}
+}
+
+// === CIRCUIT BREAKER ===
+
+func TestCircuitBreakerReleasesProbeWhenFnPanics(t *testing.T) {
+	cb := NewCircuitBreaker("test", 1, 1, 10*time.Millisecond)
+	cb.Execute(func() error { return ErrSimulatedFailure })
+	time.Sleep(20 * time.Millisecond)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic was swallowed")
+			}
+		}()
+		cb.Execute(func() error { panic("boom") })
+	}()
+
+	if state := cb.GetState(); state != Open {
+		t.Fatalf("state after panicking probe = %s, want open", state)
+	}
+
+	// The failed probe reopened the breaker; once the timeout passes the
+	// next call must be let through rather than rejected forever
+	time.Sleep(20 * time.Millisecond)
+	if err := cb.Execute(func() error { return nil }); err != nil {
+		t.Fatalf("probe after panic: %v", err)
+	}
+	if state := cb.GetState(); state != Closed {
+		t.Errorf("state = %s, want closed", state)
+	}
+}
+
+func TestTripFastFailsUntilReset(t *testing.T) {
+	cb := NewCircuitBreaker("test", 3, 1, time.Minute)
+
+	cb.Trip()
+	if state := cb.GetState(); state != Open {
+		t.Fatalf("state after Trip = %s, want open", state)
+	}
+	ran := false
+	if err := cb.Execute(func() error { ran = true; return nil }); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Execute on tripped breaker = %v, want ErrCircuitOpen", err)
+	}
+	if ran {
+		t.Error("fn ran on a tripped breaker")
+	}
+
+	cb.Reset()
+	if state := cb.GetState(); state != Closed {
+		t.Fatalf("state after Reset = %s, want closed", state)
+	}
+	if err := cb.Execute(func() error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("Execute after Reset = %v, ran %t; want nil, true", err, ran)
+	}
+}
+
+func TestResetClearsFailures(t *testing.T) {
+	cb := NewCircuitBreaker("test", 3, 1, time.Minute)
+	cb.Execute(func() error { return ErrSimulatedFailure })
+	cb.Execute(func() error { return ErrSimulatedFailure })
+	if got := cb.Failures(); got != 2 {
+		t.Fatalf("Failures = %d, want 2", got)
+	}
+
+	cb.Reset()
+	if got := cb.Failures(); got != 0 {
+		t.Errorf("Failures after Reset = %d, want 0", got)
+	}
+
+	// The count starts over, so two more failures don't reach the threshold
+	cb.Execute(func() error { return ErrSimulatedFailure })
+	cb.Execute(func() error { return ErrSimulatedFailure })
+	if state := cb.GetState(); state != Closed {
+		t.Errorf("state = %s, want closed after fewer than maxFailures since Reset", state)
+	}
+}
+
+// openAndWait fails cb once (it must open on one failure) and waits out
+// its timeout so the next call is a half-open probe
+func openAndWait(t *testing.T, cb *CircuitBreaker, timeout time.Duration) {
+	t.Helper()
+	cb.Execute(func() error { return ErrSimulatedFailure })
+	if state := cb.GetState(); state != Open {
+		t.Fatalf("state = %s, want open", state)
+	}
+	time.Sleep(timeout + 10*time.Millisecond)
+}
+
+func TestHalfOpenNeedsSuccessThresholdToClose(t *testing.T) {
+	cb := NewCircuitBreaker("test", 1, 3, 20*time.Millisecond)
+	openAndWait(t, cb, 20*time.Millisecond)
+
+	for i, want := range []CircuitBreakerState{HalfOpen, HalfOpen, Closed} {
+		if err := cb.Execute(func() error { return nil }); err != nil {
+			t.Fatalf("probe %d: %v", i+1, err)
+		}
+		if state := cb.GetState(); state != want {
+			t.Errorf("state after %d successful probes = %s, want %s", i+1, state, want)
+		}
+	}
+}
+
+func TestHalfOpenFailureResetsSuccessCount(t *testing.T) {
+	cb := NewCircuitBreaker("test", 1, 3, 20*time.Millisecond)
+	openAndWait(t, cb, 20*time.Millisecond)
+
+	cb.Execute(func() error { return nil })
+	cb.Execute(func() error { return nil })
+	cb.Execute(func() error { return ErrSimulatedFailure })
+	if state := cb.GetState(); state != Open {
+		t.Fatalf("state after a failed probe = %s, want open", state)
+	}
+
+	// The two earlier successes don't carry over: three more are needed
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		cb.Execute(func() error { return nil })
+	}
+	if state := cb.GetState(); state != HalfOpen {
+		t.Fatalf("state after 2 of 3 probes = %s, want half-open", state)
+	}
+	cb.Execute(func() error { return nil })
+	if state := cb.GetState(); state != Closed {
+		t.Errorf("state after 3 probes = %s, want closed", state)
+	}
+}
+
+func TestSuccessThresholdBelowOneMeansOne(t *testing.T) {
+	for _, threshold := range []int{0, -1} {
+		cb := NewCircuitBreaker("test", 1, threshold, 20*time.Millisecond)
+		openAndWait(t, cb, 20*time.Millisecond)
+
+		cb.Execute(func() error { return nil })
+		if state := cb.GetState(); state != Closed {
+			t.Errorf("threshold %d: state after one probe = %s, want closed", threshold, state)
+		}
+	}
+}
+
+// transition is one OnStateChange call
+type transition struct {
+	name     string
+	from, to CircuitBreakerState
+}
+
+// recordTransitions installs a hook on cb that appends to the returned slice
+func recordTransitions(cb *CircuitBreaker) *[]transition {
+	var (
+		mu  sync.Mutex
+		got []transition
+	)
+	cb.WithStateChangeHook(func(name string, from, to CircuitBreakerState) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, transition{name, from, to})
+	})
+	return &got
+}
+
+func TestOnStateChangeFiresOncePerTransition(t *testing.T) {
+	cb := NewCircuitBreaker("payments", 2, 1, 20*time.Millisecond)
+	got := recordTransitions(cb)
+	fail := func() error { return ErrSimulatedFailure }
+
+	cb.Execute(fail)
+	cb.Execute(fail) // opens
+	cb.Execute(fail) // rejected while open: no transition
+	cb.Execute(fail)
+
+	time.Sleep(30 * time.Millisecond)
+	cb.Execute(fail) // half-open probe fails, reopening
+
+	time.Sleep(30 * time.Millisecond)
+	cb.Execute(func() error { return nil }) // half-open probe succeeds, closing
+
+	want := []transition{
+		{"payments", Closed, Open},
+		{"payments", Open, HalfOpen},
+		{"payments", HalfOpen, Open},
+		{"payments", Open, HalfOpen},
+		{"payments", HalfOpen, Closed},
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("transitions = %v, want %v", *got, want)
+	}
+}
+
+func TestOnStateChangeSkipsNoOpChanges(t *testing.T) {
+	cb := NewCircuitBreaker("test", 3, 1, time.Minute)
+	got := recordTransitions(cb)
+
+	cb.Reset() // already closed
+	cb.Execute(func() error { return ErrSimulatedFailure })
+	cb.Trip()
+	cb.Trip() // already open
+	cb.Reset()
+
+	want := []transition{{"test", Closed, Open}, {"test", Open, Closed}}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("transitions = %v, want %v", *got, want)
+	}
+}
+
+func TestOnStateChangeRunsOutsideTheLock(t *testing.T) {
+	cb := NewCircuitBreaker("test", 1, 1, time.Minute)
+	var seen []CircuitBreakerState
+	cb.WithStateChangeHook(func(name string, from, to CircuitBreakerState) {
+		// Both need the breaker's lock, so they deadlock if it is still held
+		seen = append(seen, cb.GetState())
+		cb.Failures()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cb.Execute(func() error { return ErrSimulatedFailure })
+		cb.Reset()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("hook deadlocked calling back into the breaker")
+	}
+	if want := []CircuitBreakerState{Open, Closed}; !reflect.DeepEqual(seen, want) {
+		t.Errorf("hook saw states %v, want the new state each time %v", seen, want)
+	}
+}
+
+func TestCircuitBreakerStateString(t *testing.T) {
+	tests := map[CircuitBreakerState]string{
+		Closed:                 "closed",
+		Open:                   "open",
+		HalfOpen:               "half-open",
+		CircuitBreakerState(7): "CircuitBreakerState(7)",
+	}
+	for state, want := range tests {
+		if got := state.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
+
+// === LIFECYCLE ===
+
+func TestSupervisorShutdownCancelsAndWaits(t *testing.T) {
+	s := NewSupervisor()
+	var exited atomic.Int32
+	for i := 0; i < 3; i++ {
+		s.Go(func(ctx context.Context) {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond) // cleanup Shutdown must wait for
+			exited.Add(1)
+		})
+	}
+
+	if err := s.Shutdown(time.Second); err != nil {
+		t.Fatalf("Shutdown = %v, want nil", err)
+	}
+	if n := exited.Load(); n != 3 {
+		t.Errorf("%d goroutines had exited when Shutdown returned, want 3", n)
+	}
+}
+
+func TestSupervisorReportsGoroutineIgnoringCancel(t *testing.T) {
+	s := NewSupervisor()
+	stuck := make(chan struct{})
+	t.Cleanup(func() { close(stuck) })
+
+	s.Go(func(ctx context.Context) { <-ctx.Done() })
+	s.Go(func(ctx context.Context) { <-stuck })
+
+	err := s.Shutdown(20 * time.Millisecond)
+	if !errors.Is(err, ErrShutdownTimeout) {
+		t.Fatalf("Shutdown = %v, want ErrShutdownTimeout", err)
+	}
+	// Only the straggler is listed, by where it was started
+	if msg := err.Error(); !strings.Contains(msg, "1 goroutine(s)") || !strings.Contains(msg, "main_test.go:") {
+		t.Errorf("error %q, want one straggler started from main_test.go", msg)
+	}
+}
+
+func TestSupervisorIgnoresGoAfterShutdown(t *testing.T) {
+	s := NewSupervisor()
+	if err := s.Shutdown(time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := make(chan struct{})
+	s.Go(func(context.Context) { close(ran) })
+	select {
+	case <-ran:
+		t.Error("goroutine started after Shutdown")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestSemaphoreAcquiresUpToLimit(t *testing.T) {
+	sem := NewSemaphore(2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := sem.Acquire(ctx); err != nil {
+			t.Fatalf("Acquire %d: %v", i, err)
+		}
+	}
+	if sem.TryAcquire() {
+		t.Fatal("TryAcquire succeeded on a full semaphore")
+	}
+
+	sem.Release()
+	if !sem.TryAcquire() {
+		t.Error("TryAcquire failed after a Release freed a slot")
+	}
+}
+
+func TestSemaphoreAcquireBlocksUntilRelease(t *testing.T) {
+	sem := NewSemaphore(1)
+	sem.TryAcquire()
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- sem.Acquire(context.Background()) }()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("Acquire returned %v on a full semaphore", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	sem.Release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Acquire after Release = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Acquire still blocked after Release")
+	}
+}
+
+func TestSemaphoreAcquireHonorsCancel(t *testing.T) {
+	sem := NewSemaphore(1)
+	sem.TryAcquire()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sem.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Acquire with cancelled ctx = %v, want context.Canceled", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sem.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire past deadline = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The failed waits took no slot
+	sem.Release()
+	if !sem.TryAcquire() {
+		t.Error("slot lost after cancelled Acquire calls")
+	}
+}
+
+func TestSemaphoreReleaseWithoutAcquirePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Release on an empty semaphore did not panic")
+		}
+	}()
+	NewSemaphore(1).Release()
+}
+
+// === ERROR METRICS ===
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("circuit breaker x is %w", ErrCircuitOpen), "circuit_open"},
+		{fmt.Errorf("user %w", ErrNotFound), "not_found"},
+		{fmt.Errorf("%w in user creation", ErrSimulatedFailure), "simulated"},
+		{ErrReadOnly, "read_only"},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), "timeout"},
+		{context.Canceled, "canceled"},
+		{errors.New("disk full"), "internal"},
+	}
+
+	for _, tt := range tests {
+		if got := ErrorCategory(tt.err); got != tt.want {
+			t.Errorf("ErrorCategory(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorCounterIgnoresNil(t *testing.T) {
+	ec := NewErrorCounter()
+	ec.Record("CreateUser", nil)
+	if snapshot := ec.Snapshot(); len(snapshot) != 0 {
+		t.Errorf("snapshot = %v, want empty after a nil error", snapshot)
+	}
+}
+
+// newManualWindowCounter returns a counter whose clock only moves when
+// the returned advance func is called
+func newManualWindowCounter(maxAge time.Duration) (*WindowCounter, func(time.Duration)) {
+	wc := NewWindowCounter(maxAge)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	wc.now = func() time.Time { return now }
+	return wc, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestWindowCounterExcludesExpiredEvents(t *testing.T) {
+	wc, advance := newManualWindowCounter(time.Minute)
+
+	wc.Record()
+	advance(20 * time.Second)
+	wc.Record()
+	wc.Record()
+	advance(20 * time.Second)
+
+	if got := wc.CountLast(time.Minute); got != 3 {
+		t.Errorf("CountLast(1m) = %d, want 3", got)
+	}
+	if got := wc.CountLast(30 * time.Second); got != 2 {
+		t.Errorf("CountLast(30s) = %d, want the 2 recent events", got)
+	}
+
+	// The first event is now exactly a minute old and falls out
+	advance(20 * time.Second)
+	if got := wc.CountLast(time.Minute); got != 2 {
+		t.Errorf("CountLast(1m) after 60s = %d, want 2", got)
+	}
+
+	advance(time.Hour)
+	if got := wc.CountLast(time.Minute); got != 0 {
+		t.Errorf("CountLast(1m) after an hour = %d, want 0", got)
+	}
+}
+
+func TestWindowCounterGrowsPastInitialCapacity(t *testing.T) {
+	wc, advance := newManualWindowCounter(time.Minute)
+
+	// Wrap the ring once, then overflow it while it's wrapped
+	for i := 0; i < 10; i++ {
+		wc.Record()
+	}
+	advance(time.Minute)
+	for i := 0; i < 40; i++ {
+		advance(time.Millisecond)
+		wc.Record()
+	}
+
+	if got := wc.CountLast(time.Minute); got != 40 {
+		t.Errorf("CountLast = %d, want 40", got)
+	}
+	if got := wc.CountLast(10 * time.Millisecond); got != 10 {
+		t.Errorf("CountLast(10ms) = %d, want the newest 10", got)
+	}
+}
+
+func TestWindowCounterConcurrentRecords(t *testing.T) {
+	wc := NewWindowCounter(time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				wc.Record()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := wc.CountLast(time.Minute); got != 800 {
+		t.Errorf("CountLast = %d, want 800", got)
+	}
+}
+
+func TestUserServiceCountsErrorsByOperationAndCategory(t *testing.T) {
+	us := NewUserService(NewMessageBroker())
+	us.SetFailureRate(1) // every CreateUser fails until the breaker opens
+
+	for i := 0; i < us.breaker.maxFailures+2; i++ {
+		us.CreateUser("Alice", "alice@example.com")
+	}
+	us.GetUser(999)
+	us.SetReadOnly(true)
+	us.CreateUser("Bob", "bob@example.com")
+
+	want := map[string]map[string]int64{
+		"CreateUser": {"simulated": int64(us.breaker.maxFailures), "circuit_open": 2, "read_only": 1},
+		"GetUser":    {"not_found": 1},
+	}
+	if got := us.errs.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("error counts = %v, want %v", got, want)
+	}
+	if got := us.errs.RecentCount(time.Minute); got != us.breaker.maxFailures+4 {
+		t.Errorf("RecentCount = %d, want %d", got, us.breaker.maxFailures+4)
+	}
+}
+
+func TestOrderServiceCountsErrors(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	order := addOrder(os, OrderPending)
+
+	os.GetOrder(999)
+	os.UpdateStatus(999, "cancelled")
+	os.UpdateStatus(order.ID, "completed") // not an edge of the graph
+
+	if got := os.errs.Count("GetOrder", "not_found"); got != 1 {
+		t.Errorf("GetOrder not_found = %d, want 1", got)
+	}
+	if got := os.errs.Count("UpdateStatus", "not_found"); got != 1 {
+		t.Errorf("UpdateStatus not_found = %d, want 1", got)
+	}
+	if got := os.errs.Count("UpdateStatus", "internal"); got != 1 {
+		t.Errorf("UpdateStatus internal = %d, want 1 for the illegal transition", got)
+	}
+}
+
+func TestMetricsHandlerExposesErrorCounts(t *testing.T) {
+	us := NewUserService(NewMessageBroker())
+	us.SetFailureRate(1)
+	us.CreateUser("Alice", "alice@example.com")
+	os := newTestOrderService(t, NewMessageBroker())
+	os.GetOrder(999)
+	gateway := NewAPIGateway(us, os, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+
+	rec := httptest.NewRecorder()
+	gateway.metricsHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	var body struct {
+		Errors           map[string]map[string]map[string]int64 `json:"errors"`
+		ErrorsLastMinute map[string]int                         `json:"errors_last_minute"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if got := body.Errors["user_service"]["CreateUser"]["simulated"]; got != 1 {
+		t.Errorf("user_service CreateUser simulated = %d, want 1", got)
+	}
+	if got := body.Errors["order_service"]["GetOrder"]["not_found"]; got != 1 {
+		t.Errorf("order_service GetOrder not_found = %d, want 1", got)
+	}
+	if body.ErrorsLastMinute["user_service"] != 1 || body.ErrorsLastMinute["order_service"] != 1 {
+		t.Errorf("errors_last_minute = %v, want 1 each", body.ErrorsLastMinute)
+	}
+}
+
+func TestStatsHandlerReportsWorkerPool(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	gateway := NewAPIGateway(NewUserService(NewMessageBroker()), os, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+	release := make(chan struct{})
+	defer close(release)
+	os.workerPool.Submit(Job{ID: "slow", Result: make(chan error, 1), Task: func() error {
+		<-release
+		return nil
+	}})
+	Eventually(t, time.Second, time.Millisecond, func() bool { return os.workerPool.Stats().Active == 1 })
+
+	rec := httptest.NewRecorder()
+	gateway.statsHandler(rec, httptest.NewRequest(http.MethodGet, "/stats", nil))
+
+	var body struct {
+		Pool PoolStats `json:"order_worker_pool"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if want := (PoolStats{Workers: 3, Active: 1}); body.Pool != want {
+		t.Errorf("order_worker_pool = %+v, want %+v", body.Pool, want)
+	}
+}
+
+// === HEALTH ===
+
+func TestHealthHandlerReportsFailingCheck(t *testing.T) {
+	hc := NewHealthChecker()
+	hc.RegisterCheck("database", func() error { return nil })
+	hc.RegisterCheck("payments", func() error { return errors.New("connection refused") })
+	gateway := NewAPIGateway(nil, nil, nil, hc, NewBreakerRegistry(), "")
+
+	rec := httptest.NewRecorder()
+	Inject(startTimeKey, time.Now())(gateway.healthHandler)(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `"payments"`) || !strings.Contains(body, "connection refused") {
+		t.Errorf("body %s does not name the failing check", body)
+	}
+	if !strings.Contains(body, `"status":"degraded"`) {
+		t.Errorf("body %s, want overall status degraded", body)
+	}
+}
+
+func TestHealthCheckTimeoutDoesNotStallOthers(t *testing.T) {
+	hc := NewHealthChecker()
+	hc.SetTimeout(50 * time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+	hc.RegisterCheck("stuck", func() error { <-release; return nil })
+	hc.RegisterCheck("fast", func() error { return nil })
+
+	start := time.Now()
+	report := hc.CheckHealth()
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("CheckHealth took %v", elapsed)
+	}
+	if got := report.Checks["stuck"].Status; got != "unhealthy: timeout" {
+		t.Errorf("stuck check = %q, want timeout", got)
+	}
+	if got := report.Checks["fast"].Status; got != "healthy" {
+		t.Errorf("fast check = %q, want healthy", got)
+	}
+}
+
+// === CONTEXT ===
+
+// Keys only this test uses, next to the real startTimeKey
+const (
+	testNameKey contextKey = iota + 100
+	testCountKey
+)
+
+func TestInjectedValuesOfDifferentTypesDoNotCollide(t *testing.T) {
+	start := time.Now()
+	var name string
+	var count int
+	var gotStart time.Time
+	handler := Inject(startTimeKey, start)(Inject(testNameKey, "orders")(Inject(testCountKey, 3)(
+		func(w http.ResponseWriter, r *http.Request) {
+			gotStart = MustGet[time.Time](r.Context(), startTimeKey)
+			name = MustGet[string](r.Context(), testNameKey)
+			count = MustGet[int](r.Context(), testCountKey)
+		})))
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !gotStart.Equal(start) || name != "orders" || count != 3 {
+		t.Errorf("got %v, %q, %d; want %v, orders, 3", gotStart, name, count, start)
+	}
+}
+
+func TestMustGetPanicsOnWrongType(t *testing.T) {
+	handler := Inject(testCountKey, "three")(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recover() == nil {
+				t.Error("MustGet did not panic")
+			}
+		}()
+		MustGet[int](r.Context(), testCountKey)
+	})
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+// === GATEWAY ===
+
+func TestPeerHealthCheckRetriesThroughGatewayClient(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"healthy"}`))
+	}))
+	defer srv.Close()
+
+	gateway := NewAPIGateway(nil, nil, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+	check := gateway.PeerHealthCheck("peer", srv.URL)
+
+	if err := check(); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("peer saw %d requests, want 3", n)
+	}
+}
+
+func TestWatchBreakerStreamsStateChanges(t *testing.T) {
+	cb := NewCircuitBreaker("orders", 3, 1, time.Minute)
+	gateway := NewAPIGateway(nil, nil, nil, NewHealthChecker(), NewBreakerRegistry(cb), "")
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /breakers/{name}/watch", gateway.watchBreakerHandler)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/breakers/orders/watch")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+	next := func() string {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		events.ReadString('\n') // blank line ending the event
+		return strings.TrimSpace(line)
+	}
+
+	if got := next(); got != "data: closed" {
+		t.Errorf("first event = %q, want the current state", got)
+	}
+	cb.Trip()
+	if got := next(); got != "data: open" {
+		t.Errorf("event after Trip = %q, want data: open", got)
+	}
+
+	// Hanging up must release the watcher
+	resp.Body.Close()
+	Eventually(t, time.Second, 5*time.Millisecond, func() bool {
+		cb.observedState.mu.RLock()
+		defer cb.observedState.mu.RUnlock()
+		return len(cb.observedState.watchers) == 0
+	})
+}
+
+func TestWatchBreakerUnknownName(t *testing.T) {
+	gateway := NewAPIGateway(nil, nil, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+	req := httptest.NewRequest(http.MethodGet, "/breakers/nope/watch", nil)
+	req.SetPathValue("name", "nope")
+	rec := httptest.NewRecorder()
+
+	gateway.watchBreakerHandler(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestStartServerStopsWhenContextIsCancelled(t *testing.T) {
+	gateway := NewAPIGateway(nil, nil, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- gateway.StartServer(ctx, "0", time.Second) }()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("StartServer: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("StartServer did not return after cancel")
+	}
+}
+
+func TestOrdersHandlerReturnsPage(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	for i := 0; i < 5; i++ {
+		addOrder(os, OrderCompleted)
+	}
+	gateway := NewAPIGateway(nil, os, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+
+	rec := httptest.NewRecorder()
+	gateway.ordersHandler(rec, httptest.NewRequest(http.MethodGet, "/orders?offset=3&limit=2", nil))
+
+	var page Page[*Order]
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if page.Total != 5 || page.Offset != 3 || page.Limit != 2 || page.HasMore {
+		t.Errorf("page = %+v, want total 5, offset 3, limit 2, no more", page)
+	}
+	if len(page.Items) != 2 || page.Items[0].ID != 4 || page.Items[1].ID != 5 {
+		t.Errorf("items = %+v, want orders 4 and 5", page.Items)
+	}
+}
+
+func TestOrdersHandlerRejectsBadPagination(t *testing.T) {
+	gateway := NewAPIGateway(nil, newTestOrderService(t, NewMessageBroker()), nil, NewHealthChecker(), NewBreakerRegistry(), "")
+
+	for _, query := range []string{"offset=-1", "limit=0", "limit=abc"} {
+		rec := httptest.NewRecorder()
+		gateway.ordersHandler(rec, httptest.NewRequest(http.MethodGet, "/orders?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+// serveBreakerReset routes a reset request the way StartServer does
+func serveBreakerReset(gateway *APIGateway, name, auth string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/breakers/{name}/reset", gateway.requireAdmin(gateway.resetBreakerHandler))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/breakers/"+name+"/reset", nil)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestResetBreakerClosesOpenBreaker(t *testing.T) {
+	cb := NewCircuitBreaker("orders", 3, 1, time.Minute)
+	cb.Trip()
+	gateway := NewAPIGateway(nil, nil, nil, NewHealthChecker(), NewBreakerRegistry(cb), "s3cret")
+
+	rec := serveBreakerReset(gateway, "orders", "Bearer s3cret")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if body["name"] != "orders" || body["state"] != "closed" {
+		t.Errorf("body = %v, want orders closed", body)
+	}
+	if state := cb.GetState(); state != Closed {
+		t.Errorf("breaker state = %s, want closed", state)
+	}
+}
+
+func TestResetBreakerUnknownName(t *testing.T) {
+	gateway := NewAPIGateway(nil, nil, nil, NewHealthChecker(), NewBreakerRegistry(), "s3cret")
+
+	rec := serveBreakerReset(gateway, "payments", "Bearer s3cret")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestResetBreakerRequiresAdminToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		auth       string
+	}{
+		{"no header", "s3cret", ""},
+		{"wrong token", "s3cret", "Bearer guess"},
+		{"not a bearer token", "s3cret", "s3cret"},
+		{"admin routes disabled", "", "Bearer "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := NewCircuitBreaker("orders", 3, 1, time.Minute)
+			cb.Trip()
+			gateway := NewAPIGateway(nil, nil, nil, NewHealthChecker(), NewBreakerRegistry(cb), tt.adminToken)
+
+			rec := serveBreakerReset(gateway, "orders", tt.auth)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", rec.Code)
+			}
+			if state := cb.GetState(); state != Open {
+				t.Errorf("breaker state = %s, want it left open", state)
+			}
+		})
+	}
+}
+
+// getPage calls handler with GET target and decodes the Page it returns
+func getPage[T any](t *testing.T, handler http.HandlerFunc, target string) (*httptest.ResponseRecorder, Page[T]) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+	var page Page[T]
+	if rec.Code == http.StatusOK {
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec, page
+}
+
+func TestGatewayListsUsersInIDOrder(t *testing.T) {
+	us := NewUserService(NewMessageBroker())
+	us.SetFailureRate(0)
+	gateway := NewAPIGateway(us, nil, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+
+	if _, page := getPage[User](t, gateway.usersHandler, "/users"); page.Items == nil || len(page.Items) != 0 || page.Total != 0 {
+		t.Errorf("empty service page = %+v, want an empty items array", page)
+	}
+
+	for _, name := range []string{"Carol", "Alice", "Bob"} {
+		if _, err := us.CreateUser(name, strings.ToLower(name)+"@example.com"); err != nil {
+			t.Fatalf("CreateUser(%s): %v", name, err)
+		}
+	}
+
+	_, page := getPage[User](t, gateway.usersHandler, "/users")
+	var names []string
+	for i, user := range page.Items {
+		names = append(names, user.Name)
+		if i > 0 && user.ID <= page.Items[i-1].ID {
+			t.Errorf("user IDs out of order: %d after %d", user.ID, page.Items[i-1].ID)
+		}
+	}
+	if want := []string{"Carol", "Alice", "Bob"}; !reflect.DeepEqual(names, want) || page.Total != 3 {
+		t.Errorf("users = %v (total %d), want %v in creation order", names, page.Total, want)
+	}
+
+	_, page = getPage[User](t, gateway.usersHandler, "/users?offset=1&limit=1")
+	if len(page.Items) != 1 || page.Items[0].Name != "Alice" || !page.HasMore {
+		t.Errorf("second page = %+v, want just Alice with more to come", page)
+	}
+
+	if rec, _ := getPage[User](t, gateway.usersHandler, "/users?limit=abc"); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad limit: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestGatewayListsOrdersInIDOrder(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	gateway := NewAPIGateway(nil, os, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+
+	var created []int
+	for i, product := range []string{"Desk", "Chair", "Lamp"} {
+		order, err := os.CreateOrder("", i+1, product, float64(10*(i+1)))
+		if err != nil {
+			t.Fatalf("CreateOrder(%s): %v", product, err)
+		}
+		created = append(created, order.ID)
+	}
+
+	_, page := getPage[Order](t, gateway.ordersHandler, "/orders")
+	var ids []int
+	for _, order := range page.Items {
+		ids = append(ids, order.ID)
+	}
+	if !reflect.DeepEqual(ids, created) || page.Total != 3 || page.HasMore {
+		t.Errorf("order IDs = %v (total %d), want %v", ids, page.Total, created)
+	}
+}
+
+func TestGetAllReturnsCopies(t *testing.T) {
+	us := NewUserService(NewMessageBroker())
+	us.SetFailureRate(0)
+	us.CreateUser("Alice", "alice@example.com")
+	os := newTestOrderService(t, NewMessageBroker())
+	os.CreateOrder("", 1, "Desk", 250)
+
+	us.GetAll()[0].Name = "Mallory"
+	os.GetAll()[0].Product = "Stolen"
+
+	if name := us.GetAll()[0].Name; name != "Alice" {
+		t.Errorf("stored user name = %q after mutating a listed copy", name)
+	}
+	if product := os.GetAll()[0].Product; product != "Desk" {
+		t.Errorf("stored order product = %q after mutating a listed copy", product)
+	}
+}
+
+// === PAGINATION ===
+
+func TestPaginateEdgeOffsets(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []int
+		hasMore       bool
+	}{
+		{"first page", 0, 2, []int{1, 2}, true},
+		{"last full page", 3, 2, []int{4, 5}, false},
+		{"last partial page", 4, 2, []int{5}, false},
+		{"offset at end", 5, 2, []int{}, false},
+		{"offset past end", 9, 2, []int{}, false},
+		{"negative offset", -3, 2, []int{1, 2}, true},
+		{"limit covers all", 0, 5, []int{1, 2, 3, 4, 5}, false},
+		{"zero limit uses default", 0, 0, []int{1, 2, 3, 4, 5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := Paginate(items, tt.offset, tt.limit)
+			if !reflect.DeepEqual(page.Items, tt.want) || page.HasMore != tt.hasMore || page.Total != len(items) {
+				t.Errorf("Paginate(%d, %d) = %+v, want items %v, has_more %v", tt.offset, tt.limit, page, tt.want, tt.hasMore)
+			}
+		})
+	}
+}
+
+func TestPaginateCopiesItems(t *testing.T) {
+	items := []int{1, 2, 3}
+	page := Paginate(items, 0, 2)
+	page.Items[0] = 99
+	if items[0] != 1 {
+		t.Error("mutating the page changed the source slice")
+	}
+}
+
+// === SENSITIVE FIELDS ===
+
+// AssertNoSensitiveFields returns an error if v would serialize any of the
+// blocked JSON field names (case-insensitive), including nested structs.
+// It guards response types against accidentally leaking e.g. a password.
+func AssertNoSensitiveFields(v any, blocked []string) error {
+	blockedSet := make(map[string]bool, len(blocked))
+	for _, name := range blocked {
+		blockedSet[strings.ToLower(name)] = true
+	}
+	return checkSensitiveFields(reflect.TypeOf(v), blockedSet, "", make(map[reflect.Type]bool))
+}
+
+func checkSensitiveFields(t reflect.Type, blocked map[string]bool, path string, seen map[reflect.Type]bool) error {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice ||
+		t.Kind() == reflect.Array || t.Kind() == reflect.Map) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// encoding/json still promotes the fields of unexported embedded structs
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+
+		// Untagged embedded structs are flattened into the parent object
+		if field.Anonymous && name == "" {
+			if err := checkSensitiveFields(field.Type, blocked, path, seen); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		if blocked[strings.ToLower(name)] {
+			return fmt.Errorf("field %s%s serializes blocked name %q", path, field.Name, name)
+		}
+
+		if err := checkSensitiveFields(field.Type, blocked, path+field.Name+".", seen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestModelsDoNotSerializePassword(t *testing.T) {
+	for _, v := range []any{User{}, Order{}, Notification{}} {
+		if err := AssertNoSensitiveFields(v, []string{"password"}); err != nil {
+			t.Errorf("%T: %v", v, err)
+		}
+	}
+}
+
+func TestAssertNoSensitiveFieldsCatchesLeaks(t *testing.T) {
+	type account struct {
+		User
+		Password string `json:"Password"`
+	}
+	if err := AssertNoSensitiveFields(account{}, []string{"password"}); err == nil {
+		t.Error("leak not reported")
+	}
+}
+
+// === HTTP CLIENT ===
+
+type echoRequest struct {
+	Name string `json:"name"`
+}
+
+type echoResponse struct {
+	Greeting string `json:"greeting"`
+	Method   string `json:"method"`
+}
+
+// newEchoServer greets the posted name, answers GET with a fixed greeting
+// and fails /missing and /broken with 404 and 500
+func newEchoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.Error(w, "no such thing", http.StatusNotFound)
+			return
+		case "/broken":
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		case "/slow":
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		case "/garbage":
+			w.Write([]byte("not json"))
+			return
+		}
+
+		name := "world"
+		if r.Method == http.MethodPost {
+			if r.Header.Get("Content-Type") != "application/json" {
+				http.Error(w, "want JSON", http.StatusUnsupportedMediaType)
+				return
+			}
+			var req echoRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			name = req.Name
+		}
+		json.NewEncoder(w).Encode(echoResponse{Greeting: "hello " + name, Method: r.Method})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestJSONGetDecodesResponse(t *testing.T) {
+	server := newEchoServer(t)
+
+	got, err := JSONGet[echoResponse](context.Background(), server.Client(), server.URL+"/greet")
+	if err != nil {
+		t.Fatalf("JSONGet: %v", err)
+	}
+	if got != (echoResponse{Greeting: "hello world", Method: "GET"}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestJSONPostEncodesBody(t *testing.T) {
+	server := newEchoServer(t)
+
+	got, err := JSONPost[echoRequest, echoResponse](context.Background(), server.Client(), server.URL+"/greet", echoRequest{Name: "gopher"})
+	if err != nil {
+		t.Fatalf("JSONPost: %v", err)
+	}
+	if got != (echoResponse{Greeting: "hello gopher", Method: "POST"}) {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestJSONGetMapsErrorStatus(t *testing.T) {
+	server := newEchoServer(t)
+
+	for path, code := range map[string]int{"/missing": 404, "/broken": 500} {
+		_, err := JSONGet[echoResponse](context.Background(), server.Client(), server.URL+path)
+		var statusErr *HTTPStatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("%s: err = %v, want *HTTPStatusError", path, err)
+		}
+		if statusErr.StatusCode != code || statusErr.Body == "" {
+			t.Errorf("%s: got %+v, want status %d with the body", path, statusErr, code)
+		}
+	}
+}
+
+func TestJSONGetReportsBadJSONAndTimeouts(t *testing.T) {
+	server := newEchoServer(t)
+
+	if _, err := JSONGet[echoResponse](context.Background(), server.Client(), server.URL+"/garbage"); err == nil || !strings.Contains(err.Error(), "decode") {
+		t.Errorf("garbage body: err = %v, want a decode error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := JSONGet[echoResponse](ctx, server.Client(), server.URL+"/slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("slow server: err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("JSONGet took %v, want it to stop at the context deadline", elapsed)
+	}
+}
+
+// newCountingServer serves newEchoServer's routes and counts the requests
+// that actually reached it
+func newCountingServer(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	echo := newEchoServer(t)
+	var hits atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		echo.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func TestServiceClientCallsThroughBreaker(t *testing.T) {
+	server, _ := newCountingServer(t)
+	sc := NewServiceClient(server.Client(), NewCircuitBreaker("echo", 1, 1, time.Minute))
+	ctx := context.Background()
+
+	got, err := ServiceGet[echoResponse](ctx, sc, server.URL+"/greet")
+	if err != nil || got.Greeting != "hello world" {
+		t.Errorf("ServiceGet = %+v, %v", got, err)
+	}
+	posted, err := ServicePost[echoRequest, echoResponse](ctx, sc, server.URL+"/greet", echoRequest{Name: "gopher"})
+	if err != nil || posted.Greeting != "hello gopher" {
+		t.Errorf("ServicePost = %+v, %v", posted, err)
+	}
+}
+
+func TestServiceClientOpensBreakerOn5xx(t *testing.T) {
+	server, hits := newCountingServer(t)
+	breaker := NewCircuitBreaker("echo", 2, 1, time.Minute)
+	sc := NewServiceClient(server.Client(), breaker)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := ServiceGet[echoResponse](ctx, sc, server.URL+"/broken")
+		var statusErr *HTTPStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+			t.Fatalf("call %d: err = %v, want a 500 HTTPStatusError", i, err)
+		}
+	}
+	if state := breaker.GetState(); state != Open {
+		t.Fatalf("state after 2 failures = %v, want Open", state)
+	}
+
+	// Open short-circuits without touching the server, for any method
+	_, err := ServiceGet[echoResponse](ctx, sc, server.URL+"/greet")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("GET while open: err = %v, want ErrCircuitOpen", err)
+	}
+	_, err = ServicePost[echoRequest, echoResponse](ctx, sc, server.URL+"/greet", echoRequest{Name: "x"})
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("POST while open: err = %v, want ErrCircuitOpen", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("server saw %d requests, want only the 2 that failed", n)
+	}
+}
+
+func TestServiceClient4xxDoesNotTripBreaker(t *testing.T) {
+	server, hits := newCountingServer(t)
+	breaker := NewCircuitBreaker("echo", 1, 1, time.Minute)
+	sc := NewServiceClient(server.Client(), breaker)
+
+	for i := 0; i < 3; i++ {
+		_, err := ServiceGet[echoResponse](context.Background(), sc, server.URL+"/missing")
+		var statusErr *HTTPStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+			t.Fatalf("call %d: err = %v, want the 404 passed through", i, err)
+		}
+	}
+
+	if state := breaker.GetState(); state != Closed || breaker.Failures() != 0 {
+		t.Errorf("state = %v with %d failures, want Closed with none", state, breaker.Failures())
+	}
+	if n := hits.Load(); n != 3 {
+		t.Errorf("server saw %d requests, want 3", n)
+	}
+}
+
+func TestServiceClientRecoversAfterTimeout(t *testing.T) {
+	server, _ := newCountingServer(t)
+	breaker := NewCircuitBreaker("echo", 1, 1, 20*time.Millisecond)
+	sc := NewServiceClient(server.Client(), breaker)
+	ctx := context.Background()
+
+	ServiceGet[echoResponse](ctx, sc, server.URL+"/broken")
+	if state := breaker.GetState(); state != Open {
+		t.Fatalf("state = %v, want Open", state)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := ServiceGet[echoResponse](ctx, sc, server.URL+"/greet"); err != nil {
+		t.Fatalf("probe after timeout: %v", err)
+	}
+	if state := breaker.GetState(); state != Closed {
+		t.Errorf("state after a successful probe = %v, want Closed", state)
+	}
+}
+
+func TestGatewayOrdersOverHTTP(t *testing.T) {
+	os := newTestOrderService(t, NewMessageBroker())
+	gateway := NewAPIGateway(nil, os, nil, NewHealthChecker(), NewBreakerRegistry(), "")
+	server := httptest.NewServer(http.HandlerFunc(gateway.ordersHandler))
+	defer server.Close()
+	ctx := context.Background()
+
+	type createOrder struct {
+		UserID  int     `json:"user_id"`
+		Product string  `json:"product"`
+		Amount  float64 `json:"amount"`
+	}
+	created, err := JSONPost[createOrder, Order](ctx, server.Client(), server.URL, createOrder{UserID: 7, Product: "Desk", Amount: 250})
+	if err != nil {
+		t.Fatalf("POST /orders: %v", err)
+	}
+	if created.ID == 0 || created.UserID != 7 || created.Product != "Desk" {
+		t.Errorf("created = %+v", created)
+	}
+
+	page, err := JSONGet[Page[Order]](ctx, server.Client(), server.URL+"?limit=10")
+	if err != nil {
+		t.Fatalf("GET /orders: %v", err)
+	}
+	if page.Total != 1 || len(page.Items) != 1 || page.Items[0].ID != created.ID {
+		t.Errorf("page = %+v, want the created order", page)
+	}
+
+	_, err = JSONGet[Page[Order]](ctx, server.Client(), server.URL+"?limit=0")
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("bad limit: err = %v, want a 400 HTTPStatusError", err)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -65,6 +68,80 @@ type APIResponse struct {
 	Error   string      `json:"error,omitempty"`
 }
 
+// Page is one window of a larger list plus the metadata needed to fetch more
+type Page[T any] struct {
+	Items   []T  `json:"items"`
+	Total   int  `json:"total"`
+	Offset  int  `json:"offset"`
+	Limit   int  `json:"limit"`
+	HasMore bool `json:"has_more"`
+}
+
+// defaultPageLimit is used when a list request doesn't specify ?limit
+const defaultPageLimit = 20
+
+// Paginate returns items[offset:offset+limit] as a Page. Out-of-range
+// offsets yield an empty page rather than an error.
+func Paginate[T any](items []T, offset, limit int) Page[T] {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+
+	start := min(offset, len(items))
+	end := min(start+limit, len(items))
+
+	return Page[T]{
+		Items:   append([]T{}, items[start:end]...),
+		Total:   len(items),
+		Offset:  offset,
+		Limit:   limit,
+		HasMore: end < len(items),
+	}
+}
+
+// maxPageLimit caps ?limit; larger values are clamped to it
+var maxPageLimit = 100
+
+// ErrInvalidPagination is wrapped by parsePagination errors (map to 400)
+var ErrInvalidPagination = errors.New("invalid pagination")
+
+// parsePagination reads ?offset= and ?limit=. Missing values use defaults
+// and a limit above maxPageLimit is clamped; anything else out of range
+// returns an error wrapping ErrInvalidPagination.
+func parsePagination(r *http.Request) (offset, limit int, err error) {
+	query := r.URL.Query()
+
+	if raw := query.Get("offset"); raw != "" {
+		offset, err = strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("%w: offset must be a non-negative integer, got %q", ErrInvalidPagination, raw)
+		}
+	}
+
+	limit = defaultPageLimit
+	if raw := query.Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("%w: limit must be a positive integer, got %q", ErrInvalidPagination, raw)
+		}
+	}
+
+	return offset, min(limit, maxPageLimit), nil
+}
+
+// writePaginationError sends a 400 for a parsePagination error
+func writePaginationError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: false,
+		Error:   err.Error(),
+	})
+}
+
 // === IN-MEMORY DATA STORE ===
 
 var (
@@ -81,6 +158,28 @@ var (
 	}
 )
 
+// === BUILD INFO ===
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "dev"
+	buildTime = "dev"
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+func currentBuildInfo() BuildInfo {
+	return BuildInfo{Version: version, Commit: commit, BuildTime: buildTime}
+}
+
 // === BASIC HTTP HANDLERS ===
 
 // 1. Simple Hello World handler
@@ -144,10 +243,17 @@ func getUsersHandler(w http.ResponseWriter, r *http.Request) {
 	for _, user := range users {
 		userList = append(userList, user)
 	}
+	sortByID(userList, func(u *User) int { return u.ID })
+
+	offset, limit, err := parsePagination(r)
+	if err != nil {
+		writePaginationError(w, err)
+		return
+	}
 
 	response := APIResponse{
 		Success: true,
-		Data:    userList,
+		Data:    Paginate(userList, offset, limit),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -236,10 +342,17 @@ func getProductsHandler(w http.ResponseWriter, r *http.Request) {
 			productList = append(productList, product)
 		}
 	}
+	sortByID(productList, func(p *Product) int { return p.ID })
+
+	offset, limit, err := parsePagination(r)
+	if err != nil {
+		writePaginationError(w, err)
+		return
+	}
 
 	response := APIResponse{
 		Success: true,
-		Data:    productList,
+		Data:    Paginate(productList, offset, limit),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -274,6 +387,15 @@ func createProductHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// sortByID sorts items in place by ascending ID.
+// Map iteration order is random, so list handlers sort before encoding
+// to keep responses deterministic.
+func sortByID[T any](items []T, id func(T) int) {
+	sort.Slice(items, func(i, j int) bool {
+		return id(items[i]) < id(items[j])
+	})
+}
+
 // === MIDDLEWARE ===
 
 // 7. Logging middleware
@@ -329,6 +451,71 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// === CONTEXT HELPERS ===
+
+// contextKey is unexported so other packages can't collide with our keys
+type contextKey int
+
+const (
+	startTimeKey contextKey = iota
+)
+
+// Inject returns middleware that stores value under key in every request context
+func Inject[T any](key contextKey, value T) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			next(w, r.WithContext(context.WithValue(r.Context(), key, value)))
+		}
+	}
+}
+
+// MustGet returns the T stored under key, panicking if it is missing.
+// Only use it for values a middleware is guaranteed to have injected.
+func MustGet[T any](ctx context.Context, key contextKey) T {
+	value, ok := ctx.Value(key).(T)
+	if !ok {
+		panic(fmt.Sprintf("context value for key %v is missing or not a %T", key, value))
+	}
+	return value
+}
+
+// === ROUTING ===
+
+// Middleware wraps a handler with extra behaviour
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Route declares an endpoint together with the middleware it runs through,
+// so the whole stack can be read from one table. An empty Method matches
+// every method and leaves dispatch to the handler.
+type Route struct {
+	Path        string
+	Method      string
+	Handler     http.HandlerFunc
+	Middlewares []Middleware
+}
+
+// Build applies the route's middlewares; the first one listed is outermost
+func (rt Route) Build() http.HandlerFunc {
+	handler := rt.Handler
+	for i := len(rt.Middlewares) - 1; i >= 0; i-- {
+		handler = rt.Middlewares[i](handler)
+	}
+	return handler
+}
+
+// NewRouter registers every route on a fresh ServeMux
+func NewRouter(routes []Route) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, rt := range routes {
+		pattern := rt.Path
+		if rt.Method != "" {
+			pattern = rt.Method + " " + rt.Path
+		}
+		mux.HandleFunc(pattern, rt.Build())
+	}
+	return mux
+}
+
 // === TEMPLATE RENDERING ===
 
 // 10. HTML template handler
@@ -392,11 +579,13 @@ func templateHandler(w http.ResponseWriter, r *http.Request) {
 	for _, user := range users {
 		userList = append(userList, user)
 	}
+	sortByID(userList, func(u *User) int { return u.ID })
 
 	productList := make([]*Product, 0, len(products))
 	for _, product := range products {
 		productList = append(productList, product)
 	}
+	sortByID(productList, func(p *Product) int { return p.ID })
 
 	data := struct {
 		Users       []*User
@@ -477,8 +666,9 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	health := map[string]interface{}{
 		"status":    "healthy",
 		"timestamp": time.Now().Format(time.RFC3339),
-		"uptime":    "unknown", // In a real app, track uptime
-		"version":   "1.0.0",
+		"uptime":    time.Since(MustGet[time.Time](r.Context(), startTimeKey)).Round(time.Second).String(),
+		"version":   version,
+		"build":     currentBuildInfo(),
 		"services": map[string]string{
 			"database": "healthy",
 			"cache":    "healthy",
@@ -495,6 +685,17 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// versionHandler reports the build info baked in via -ldflags
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	response := APIResponse{
+		Success: true,
+		Data:    currentBuildInfo(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // === ERROR HANDLING ===
 
 // 13. Not found handler
@@ -514,35 +715,44 @@ func notFoundHandler(w http.ResponseWriter, r *http.Request) {
 func main() {
 	fmt.Println("=== GO WEB SERVER COMPREHENSIVE GUIDE ===")
 
-	// === BASIC ROUTES ===
-	http.HandleFunc("/", loggingMiddleware(corsMiddleware(helloHandler)))
-	http.HandleFunc("/json", loggingMiddleware(corsMiddleware(jsonHandler)))
-	http.HandleFunc("/request-info", loggingMiddleware(corsMiddleware(requestInfoHandler)))
+	public := []Middleware{loggingMiddleware, corsMiddleware}
+	withStartTime := Inject(startTimeKey, time.Now())
+
+	routes := []Route{
+		// === BASIC ROUTES ===
+		{Path: "/", Handler: helloHandler, Middlewares: public},
+		{Path: "/json", Handler: jsonHandler, Middlewares: public},
+		{Path: "/request-info", Handler: requestInfoHandler, Middlewares: public},
 
-	// === API ROUTES ===
-	http.HandleFunc("/api/users", loggingMiddleware(corsMiddleware(usersHandler)))
-	http.HandleFunc("/api/users/", loggingMiddleware(corsMiddleware(userHandler)))
-	http.HandleFunc("/api/products", loggingMiddleware(corsMiddleware(productsHandler)))
+		// === API ROUTES ===
+		{Path: "/api/users", Handler: usersHandler, Middlewares: public},
+		{Path: "/api/users/", Handler: userHandler, Middlewares: public},
+		{Path: "/api/products", Handler: productsHandler, Middlewares: public},
 
-	// === PROTECTED ROUTES ===
-	http.HandleFunc("/api/admin/users", loggingMiddleware(corsMiddleware(authMiddleware(getUsersHandler))))
+		// === PROTECTED ROUTES ===
+		{Path: "/api/admin/users", Handler: getUsersHandler,
+			Middlewares: []Middleware{loggingMiddleware, corsMiddleware, authMiddleware}},
 
-	// === TEMPLATE ROUTES ===
-	http.HandleFunc("/dashboard", loggingMiddleware(templateHandler))
+		// === TEMPLATE ROUTES ===
+		{Path: "/dashboard", Handler: templateHandler,
+			Middlewares: []Middleware{loggingMiddleware}},
 
-	// === STATIC FILES ===
-	http.HandleFunc("/static/", staticHandler)
+		// === STATIC FILES ===
+		{Path: "/static/", Handler: staticHandler},
 
-	// === HEALTH CHECK ===
-	http.HandleFunc("/health", loggingMiddleware(corsMiddleware(healthHandler)))
+		// === HEALTH CHECK ===
+		{Path: "/health", Handler: healthHandler,
+			Middlewares: []Middleware{loggingMiddleware, corsMiddleware, withStartTime}},
+		{Path: "/version", Handler: versionHandler, Middlewares: public},
+	}
 
 	// === 404 HANDLER ===
-	// Note: This won't work as expected with http.HandleFunc
-	// For proper 404 handling, use a custom ServeMux or router
+	// Note: "/" catches every unmatched path, so helloHandler sees them too
 
 	// === SERVER CONFIGURATION ===
 	server := &http.Server{
 		Addr:         ":8080",
+		Handler:      NewRouter(routes),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -555,7 +765,7 @@ func main() {
 	fmt.Println("GET    /                     - Hello World")
 	fmt.Println("GET    /json                 - JSON response")
 	fmt.Println("GET    /request-info         - Request information")
-	fmt.Println("GET    /api/users            - List users")
+	fmt.Println("GET    /api/users            - List users (?offset=&limit=)")
 	fmt.Println("POST   /api/users            - Create user")
 	fmt.Println("GET    /api/users/{id}       - Get user by ID")
 	fmt.Println("GET    /api/products         - List products")
@@ -565,6 +775,7 @@ func main() {
 	fmt.Println("GET    /dashboard            - HTML dashboard")
 	fmt.Println("GET    /static/styles.css    - CSS file")
 	fmt.Println("GET    /health               - Health check")
+	fmt.Println("GET    /version              - Build version info")
 	fmt.Println()
 	fmt.Println("Example requests:")
 	fmt.Println("curl http://localhost:8080/")
@@ -583,6 +794,9 @@ RUNNING THE WEB SERVER:
 1. Run the server:
    go run main.go
 
+   Or stamp build info into /health and /version:
+   go run -ldflags "-X main.version=1.2.0 -X main.commit=abc123" main.go
+
 2. Test endpoints:
    curl http://localhost:8080/
    curl http://localhost:8080/api/users
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// === ROUTING ===
+
+func TestNewRouterAppliesMiddlewaresInOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next(w, r)
+			}
+		}
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) { calls = append(calls, "handler") }
+
+	router := NewRouter([]Route{
+		{Path: "/traced", Handler: handler, Middlewares: []Middleware{trace("outer"), trace("inner")}},
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/traced", nil))
+
+	if got := strings.Join(calls, ","); got != "outer,inner,handler" {
+		t.Errorf("calls = %s, want outer,inner,handler", got)
+	}
+}
+
+func TestNewRouterMethodRestriction(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router := NewRouter([]Route{
+		{Path: "/any", Handler: ok},
+		{Path: "/post-only", Method: http.MethodPost, Handler: ok},
+	})
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/any", http.StatusOK},
+		{http.MethodPost, "/any", http.StatusOK},
+		{http.MethodDelete, "/any", http.StatusOK},
+		{http.MethodPost, "/post-only", http.StatusOK},
+		{http.MethodGet, "/post-only", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
+
+// === CONTEXT ===
+
+// Keys only these tests use, next to the real startTimeKey
+const (
+	testNameKey contextKey = iota + 100
+	testCountKey
+)
+
+func TestInjectedValuesOfDifferentTypesDoNotCollide(t *testing.T) {
+	start := time.Now()
+	var name string
+	var count int
+	var gotStart time.Time
+	handler := Route{
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			gotStart = MustGet[time.Time](r.Context(), startTimeKey)
+			name = MustGet[string](r.Context(), testNameKey)
+			count = MustGet[int](r.Context(), testCountKey)
+		},
+		Middlewares: []Middleware{Inject(startTimeKey, start), Inject(testNameKey, "users"), Inject(testCountKey, 3)},
+	}.Build()
+
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !gotStart.Equal(start) || name != "users" || count != 3 {
+		t.Errorf("got %v, %q, %d; want %v, users, 3", gotStart, name, count, start)
+	}
+}
+
+func TestMustGetPanicsWhenMissing(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustGet did not panic")
+		}
+	}()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	MustGet[time.Time](req.Context(), startTimeKey)
+}
+
+// === PAGINATION ===
+
+func TestPaginateBoundsAtEdgeOffsets(t *testing.T) {
+	items := []string{"a", "b", "c"}
+	tests := []struct {
+		offset, limit int
+		want          []string
+		hasMore       bool
+	}{
+		{0, 1, []string{"a"}, true},
+		{1, 2, []string{"b", "c"}, false},
+		{2, 1, []string{"c"}, false},
+		{3, 1, []string{}, false},
+		{10, 1, []string{}, false},
+		{-1, 2, []string{"a", "b"}, true},
+		{0, -5, []string{"a", "b", "c"}, false},
+	}
+
+	for _, tt := range tests {
+		page := Paginate(items, tt.offset, tt.limit)
+		if !reflect.DeepEqual(page.Items, tt.want) || page.HasMore != tt.hasMore || page.Total != 3 {
+			t.Errorf("Paginate(offset %d, limit %d) = %+v, want %v with has_more %v",
+				tt.offset, tt.limit, page, tt.want, tt.hasMore)
+		}
+	}
+}
+
+func TestGetUsersHandlerPastTheEnd(t *testing.T) {
+	rec := httptest.NewRecorder()
+	getUsersHandler(rec, httptest.NewRequest(http.MethodGet, "/api/users?offset=3&limit=2", nil))
+
+	var body struct {
+		Success bool       `json:"success"`
+		Data    Page[User] `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	page := body.Data
+	if !body.Success || page.Items == nil || len(page.Items) != 0 || page.Total != len(users) || page.HasMore {
+		t.Errorf("page = %+v, want an empty items array and total %d", page, len(users))
+	}
+	if !strings.Contains(rec.Body.String(), `"items":[]`) {
+		t.Errorf("body %s, want items encoded as []", rec.Body)
+	}
+}
+
+func TestParsePaginationValid(t *testing.T) {
+	tests := []struct {
+		query         string
+		offset, limit int
+	}{
+		{"", 0, defaultPageLimit},
+		{"offset=0&limit=1", 0, 1},
+		{"offset=40&limit=20", 40, 20},
+		{"limit=100", 0, 100},
+		{"limit=101", 0, 100}, // clamped to maxPageLimit
+		{"limit=1000000", 0, 100},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/users?"+tt.query, nil)
+		offset, limit, err := parsePagination(r)
+		if err != nil || offset != tt.offset || limit != tt.limit {
+			t.Errorf("parsePagination(%q) = %d, %d, %v; want %d, %d, nil", tt.query, offset, limit, err, tt.offset, tt.limit)
+		}
+	}
+}
+
+func TestParsePaginationRejectsInvalid(t *testing.T) {
+	for _, query := range []string{
+		"offset=-1",
+		"offset=abc",
+		"offset=1.5",
+		"limit=0",
+		"limit=-5",
+		"limit=ten",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/users?"+query, nil)
+		if _, _, err := parsePagination(r); !errors.Is(err, ErrInvalidPagination) {
+			t.Errorf("parsePagination(%q) error = %v, want ErrInvalidPagination", query, err)
+		}
+	}
+}
+
+func TestParsePaginationHonorsConfiguredMax(t *testing.T) {
+	defer func(old int) { maxPageLimit = old }(maxPageLimit)
+	maxPageLimit = 10
+
+	r := httptest.NewRequest(http.MethodGet, "/users?limit=50", nil)
+	if _, limit, err := parsePagination(r); err != nil || limit != 10 {
+		t.Errorf("limit = %d, %v; want clamped to the configured 10", limit, err)
+	}
+}
+
+func TestGetUsersHandlerRejectsBadPagination(t *testing.T) {
+	rec := httptest.NewRecorder()
+	getUsersHandler(rec, httptest.NewRequest(http.MethodGet, "/api/users?limit=0", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	var body APIResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if body.Success || !strings.Contains(body.Error, "limit") {
+		t.Errorf("body = %+v, want a failure naming limit", body)
+	}
+}
+
+// === ORDERING ===
+
+func TestSortByID(t *testing.T) {
+	items := []*Product{{ID: 3}, {ID: 1}, {ID: 42}, {ID: 2}}
+	sortByID(items, func(p *Product) int { return p.ID })
+
+	var ids []int
+	for _, p := range items {
+		ids = append(ids, p.ID)
+	}
+	if want := []int{1, 2, 3, 42}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want %v", ids, want)
+	}
+}
+
+// withStore swaps the in-memory users and products for the test's own
+func withStore(t *testing.T, u map[int]*User, p map[int]*Product) {
+	t.Helper()
+	oldUsers, oldProducts := users, products
+	users, products = u, p
+	t.Cleanup(func() { users, products = oldUsers, oldProducts })
+}
+
+func TestListHandlersReturnItemsSortedByID(t *testing.T) {
+	// Insert out of order; map iteration is random on top of that
+	u := map[int]*User{}
+	p := map[int]*Product{}
+	for _, id := range []int{9, 4, 7, 1, 12, 3, 8} {
+		u[id] = &User{ID: id, Name: "user"}
+		p[id] = &Product{ID: id, Name: "product", InStock: true}
+	}
+	withStore(t, u, p)
+	want := []int{1, 3, 4, 7, 8, 9, 12}
+
+	// Repeat so a lucky map order can't hide a missing sort
+	for i := 0; i < 20; i++ {
+		rec := httptest.NewRecorder()
+		getUsersHandler(rec, httptest.NewRequest(http.MethodGet, "/api/users", nil))
+		var userBody struct {
+			Data Page[User] `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &userBody)
+		var userIDs []int
+		for _, user := range userBody.Data.Items {
+			userIDs = append(userIDs, user.ID)
+		}
+		if !reflect.DeepEqual(userIDs, want) {
+			t.Fatalf("user ids = %v, want %v", userIDs, want)
+		}
+
+		rec = httptest.NewRecorder()
+		getProductsHandler(rec, httptest.NewRequest(http.MethodGet, "/api/products?in_stock=true", nil))
+		var productBody struct {
+			Data Page[Product] `json:"data"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &productBody)
+		var productIDs []int
+		for _, product := range productBody.Data.Items {
+			productIDs = append(productIDs, product.ID)
+		}
+		if !reflect.DeepEqual(productIDs, want) {
+			t.Fatalf("product ids = %v, want %v", productIDs, want)
+		}
+	}
+}
+
+// === BUILD INFO ===
+
+func TestVersionHandlerDefaultsToDev(t *testing.T) {
+	rec := httptest.NewRecorder()
+	versionHandler(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body struct {
+		Success bool                   `json:"success"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	want := map[string]interface{}{"version": "dev", "commit": "dev", "build_time": "dev"}
+	if !body.Success || !reflect.DeepEqual(body.Data, want) {
+		t.Errorf("body = %+v, want success with %v", body, want)
+	}
+}
+
+func TestVersionHandlerReportsLinkedValues(t *testing.T) {
+	// What -ldflags -X would have set
+	defer func(v, c, b string) { version, commit, buildTime = v, c, b }(version, commit, buildTime)
+	version, commit, buildTime = "1.2.0", "abc123", "2024-01-01T00:00:00Z"
+
+	rec := httptest.NewRecorder()
+	versionHandler(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var body struct {
+		Data BuildInfo `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if want := (BuildInfo{"1.2.0", "abc123", "2024-01-01T00:00:00Z"}); body.Data != want {
+		t.Errorf("build info = %+v, want %+v", body.Data, want)
+	}
+}
+
+func TestHealthHandlerIncludesBuildInfo(t *testing.T) {
+	handler := Route{Handler: healthHandler, Middlewares: []Middleware{Inject(startTimeKey, time.Now())}}.Build()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var body struct {
+		Data struct {
+			Status  string    `json:"status"`
+			Version string    `json:"version"`
+			Build   BuildInfo `json:"build"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if body.Data.Status != "healthy" || body.Data.Version != "dev" {
+		t.Errorf("health = %+v, want healthy and version dev", body.Data)
+	}
+	if want := (BuildInfo{"dev", "dev", "dev"}); body.Data.Build != want {
+		t.Errorf("build = %+v, want %+v", body.Data.Build, want)
+	}
+}